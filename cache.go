@@ -0,0 +1,257 @@
+package vpl
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 组件缓存: 缓存组件渲染得到的html(包括其中<parallel>的结果), 在过期之前调用组件时直接输出缓存的结果.
+//
+//	v.CacheComponent("sidebar", func(props *vpl.Props) string {
+//		user, _ := props.Get("user")
+//		return fmt.Sprint(user)
+//	}, time.Minute)
+//
+// 和v-memo一样, 组件中使用的样式和推送到输出口的内容会和结果一起缓存.
+
+// CacheStore 保存组件缓存的渲染结果, 见 Vpl.CacheComponent. 实现需要并发安全.
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	// ttl为0时不过期
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// NewLRUCacheStore 返回在内存中保存结果的CacheStore, 最多保存size个结果, 超过时淘汰最久没有使用的结果.
+func NewLRUCacheStore(size int) CacheStore {
+	return &lruStore{c: newLRUCache(size)}
+}
+
+type lruStore struct {
+	c *lruCache
+}
+
+func (s *lruStore) Get(key string) ([]byte, bool) {
+	v, ok := s.c.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+func (s *lruStore) Set(key string, value []byte, ttl time.Duration) {
+	s.c.Set(key, value, ttl)
+}
+
+func (s *lruStore) Delete(key string) {
+	s.c.Delete(key)
+}
+
+// 并发安全的LRU缓存, 超过size时淘汰最久没有使用的值
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+	// 为零值时不过期
+	expire time.Time
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (c *lruCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*lruEntry)
+	if !entry.expire.IsZero() && time.Now().After(entry.expire) {
+		c.remove(e)
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return entry.value, true
+}
+
+// ttl为0时不过期
+func (c *lruCache) Set(key string, value interface{}, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		entry := e.Value.(*lruEntry)
+		entry.value = value
+		entry.expire = expire
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expire: expire})
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *lruCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+}
+
+// 需要持有锁
+func (c *lruCache) remove(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.items, e.Value.(*lruEntry).key)
+}
+
+func (c *lruCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// CacheStats 组件缓存的命中次数
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// 一个组件的缓存设置
+type componentCache struct {
+	// 使用atomic访问, 需要放在最前面以保证64位对齐
+	hits   int64
+	misses int64
+
+	name string
+	key  func(props *Props) string
+	ttl  time.Duration
+}
+
+// CacheStore中使用的key, generation是组件的版本, 见registry.generation
+func componentCacheKey(name string, generation int64, key string) string {
+	return fmt.Sprintf("%s:%d:%s", name, generation, key)
+}
+
+var errCacheKeyPanic = errors.New("cache key panic")
+
+// 调用CacheComponent传入的key函数, 将panic转为错误
+func (cc *componentCache) cacheKey(props *Props) (key string, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%w: %v", errCacheKeyPanic, e)
+		}
+	}()
+	return cc.key(props), nil
+}
+
+// 调用组件, 组件设置了缓存时使用缓存.
+// 静态调用与动态组件(<component :is>)都通过这里调用组件
+func execCachedComponent(ctx *StatementCtx, name string, props *Props, exec func(ctx *StatementCtx) error) error {
+	cc, ok := ctx.caches[name]
+	if !ok {
+		return exec(ctx)
+	}
+	return cc.exec(ctx, ctx.generation, props, exec)
+}
+
+// 渲染组件, 没有命中缓存时在结果计算完成之后写入缓存
+func (cc *componentCache) exec(ctx *StatementCtx, generation int64, props *Props, exec func(ctx *StatementCtx) error) error {
+	key, err := cc.cacheKey(props)
+	if err != nil {
+		return err
+	}
+	if key == "" || ctx.cacheStore == nil {
+		return exec(ctx)
+	}
+	key = componentCacheKey(cc.name, generation, key)
+
+	if bs, ok := ctx.cacheStore.Get(key); ok {
+		var r memoResult
+		if json.Unmarshal(bs, &r) == nil {
+			atomic.AddInt64(&cc.hits, 1)
+			r.writeTo(ctx)
+			return nil
+		}
+	}
+	atomic.AddInt64(&cc.misses, 1)
+
+	store := ctx.cacheStore
+	return renderCached(ctx, exec, func(r *memoResult) {
+		bs, err := json.Marshal(r)
+		if err != nil {
+			return
+		}
+		store.Set(key, bs, cc.ttl)
+	})
+}
+
+func (r *registry) setCache(name string, cc *componentCache) {
+	caches := make(map[string]*componentCache, len(r.caches)+1)
+	for k, c := range r.caches {
+		caches[k] = c
+	}
+	if cc != nil {
+		caches[name] = cc
+	} else {
+		delete(caches, name)
+	}
+	r.caches = caches
+}
+
+// CacheComponent 缓存组件的渲染结果, 调用组件时使用key(props)得到缓存的key, 相同的key在ttl之内直接输出缓存的结果.
+// key返回空字符串时不缓存这次调用; ttl为0时不过期(直到被淘汰或InvalidateComponent).
+// 结果保存在CacheStore中, 见WithCacheStore. key为nil时取消缓存.
+//
+// 组件的输出应该只由key决定, 如果调用组件时传递了不同的slot, 需要将其区分体现在key中.
+func (v *Vpl) CacheComponent(name string, key func(props *Props) string, ttl time.Duration) {
+	var cc *componentCache
+	if key != nil {
+		cc = &componentCache{name: name, key: key, ttl: ttl}
+	}
+	v.modify(func(r *registry) {
+		r.setCache(name, cc)
+	})
+}
+
+// InvalidateComponent 删除组件缓存中key对应的结果(当前版本的组件)
+func (v *Vpl) InvalidateComponent(name string, key string) {
+	if v.cacheStore == nil {
+		return
+	}
+	v.cacheStore.Delete(componentCacheKey(name, v.load().generation, key))
+}
+
+// CacheStats 返回组件缓存的命中次数, 重新调用CacheComponent时会重置
+func (v *Vpl) CacheStats(name string) CacheStats {
+	cc, ok := v.load().caches[name]
+	if !ok {
+		return CacheStats{}
+	}
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&cc.hits),
+		Misses: atomic.LoadInt64(&cc.misses),
+	}
+}
@@ -0,0 +1,106 @@
+package vpl
+
+import "strings"
+
+// 已知的html元素, 在编译时会被当做标签渲染, 其他的tag则被当做组件.
+// 包括 HTML5 / SVG / MathML 元素.
+// 注意 template/slot 等内置组件不在这里.
+var htmlElements = map[string]bool{}
+
+func init() {
+	for _, list := range [][]string{htmlElementNames, svgElementNames, mathElementNames} {
+		for _, name := range list {
+			htmlElements[name] = true
+		}
+	}
+}
+
+var htmlElementNames = []string{
+	"a", "abbr", "address", "area", "article", "aside", "audio",
+	"b", "base", "bdi", "bdo", "blockquote", "body", "br", "button",
+	"canvas", "caption", "cite", "code", "col", "colgroup",
+	"data", "datalist", "dd", "del", "details", "dfn", "dialog", "div", "dl", "dt",
+	"em", "embed",
+	"fieldset", "figcaption", "figure", "footer", "form",
+	"h1", "h2", "h3", "h4", "h5", "h6", "head", "header", "hgroup", "hr", "html",
+	"i", "iframe", "img", "input", "ins",
+	"kbd",
+	"label", "legend", "li", "link",
+	"main", "map", "mark", "menu", "meta", "meter",
+	"nav", "noscript",
+	"object", "ol", "optgroup", "option", "output",
+	"p", "param", "picture", "pre", "progress",
+	"q",
+	"rp", "rt", "ruby",
+	"s", "samp", "script", "search", "section", "select", "small", "source", "span", "strong", "style", "sub", "summary", "sup",
+	"table", "tbody", "td", "textarea", "tfoot", "th", "thead", "time", "title", "tr", "track",
+	"u", "ul",
+	"var", "video",
+	"wbr",
+	// 已废弃但仍然常见的元素
+	"acronym", "applet", "basefont", "big", "center", "dir", "font", "frame", "frameset",
+	"keygen", "marquee", "menuitem", "nobr", "noembed", "noframes", "plaintext", "rb", "rtc", "strike", "tt", "xmp",
+}
+
+var svgElementNames = []string{
+	"svg", "animate", "animateMotion", "animateTransform", "circle", "clipPath", "defs", "desc", "discard", "ellipse",
+	"feBlend", "feColorMatrix", "feComponentTransfer", "feComposite", "feConvolveMatrix", "feDiffuseLighting",
+	"feDisplacementMap", "feDistantLight", "feDropShadow", "feFlood", "feFuncA", "feFuncB", "feFuncG", "feFuncR",
+	"feGaussianBlur", "feImage", "feMerge", "feMergeNode", "feMorphology", "feOffset", "fePointLight",
+	"feSpecularLighting", "feSpotLight", "feTile", "feTurbulence", "filter", "foreignObject",
+	"g", "image", "line", "linearGradient", "marker", "mask", "metadata", "mpath", "path", "pattern",
+	"polygon", "polyline", "radialGradient", "rect", "set", "stop", "switch", "symbol",
+	"text", "textPath", "tspan", "use", "view",
+}
+
+var mathElementNames = []string{
+	"math", "annotation", "annotation-xml", "maction", "menclose", "merror", "mfenced", "mfrac", "mi",
+	"mmultiscripts", "mn", "mo", "mover", "mpadded", "mphantom", "mprescripts", "mroot", "mrow", "ms",
+	"mspace", "msqrt", "mstyle", "msub", "msubsup", "msup", "mtable", "mtd", "mtext", "mtr",
+	"munder", "munderover", "none", "semantics",
+}
+
+// 总是作为标签渲染的基础元素(与之前版本的标签表相同), 注册同名组件不会生效.
+// header/footer常被用作布局组件的名字, 不在其中.
+var basicElements = map[string]bool{
+	"html": true, "head": true, "body": true, "meta": true, "title": true, "style": true, "script": true, "link": true,
+	"div": true, "p": true, "span": true, "a": true, "i": true, "img": true, "input": true, "button": true, "object": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "br": true,
+	"blockquote": true, "pre": true, "code": true, "center": true, "ul": true, "li": true,
+	"table": true, "thead": true, "tbody": true, "tr": true, "th": true, "td": true,
+}
+
+// 判断tag是否是html元素(编译为标签), 否则编译为组件调用
+func (c *compiler) isElement(tag string) bool {
+	if is, ok := c.elements[tag]; ok {
+		return is
+	}
+	return htmlElements[tag]
+}
+
+// 除基础元素之外的html元素(如 <main>/<nav>/<header>)在注册了同名组件时渲染组件, 否则作为标签渲染.
+// 通过WithElements声明为true的tag, 以及组件中与组件同名的tag(如main组件中的<main>)总是作为标签渲染.
+func (c *compiler) canBeComponent(tag string) bool {
+	if _, ok := c.elements[tag]; ok {
+		return false
+	}
+	return htmlElements[tag] && !basicElements[tag] && tag != c.component
+}
+
+// 自定义元素(如 <my-element>)在没有注册为同名组件时, 会作为普通标签渲染.
+// 通过WithElements声明为false的tag只会被当做组件.
+func (c *compiler) isCustomElement(tag string) bool {
+	if _, ok := c.elements[tag]; ok {
+		return false
+	}
+	return isCustomElementName(tag)
+}
+
+// 自定义元素的名字需要以小写字母开头并且包含"-"
+// https://html.spec.whatwg.org/multipage/custom-elements.html#valid-custom-element-name
+func isCustomElementName(tag string) bool {
+	if tag == "" || tag[0] < 'a' || tag[0] > 'z' {
+		return false
+	}
+	return strings.Contains(tag, "-")
+}
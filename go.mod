@@ -1,6 +1,6 @@
 module github.com/zbysir/vpl
 
-go 1.13
+go 1.16
 
 require (
 	github.com/CloudyKit/fastprinter v0.0.0-20200109182630-33d98a066a53 // indirect
@@ -63,6 +63,8 @@ type Lexer struct {
 
 	rawTag Hash
 	inTag  bool
+	// svg与math按照html解析, 见DisableRawXml
+	noRawXml bool
 
 	text    []byte
 	attrVal []byte
@@ -88,6 +90,16 @@ func (l *Lexer) Text() []byte {
 	return l.text
 }
 
+// DisableRawXml makes the lexer tokenize the content of svg and math tags like html, instead of returning them as a single SvgToken or MathToken.
+func (l *Lexer) DisableRawXml() {
+	l.noRawXml = true
+}
+
+// Offset returns the offset in the input of the end of the last token returned from Next, which is also the start of the next token.
+func (l *Lexer) Offset() int {
+	return l.r.Offset()
+}
+
 // AttrVal returns the attribute value when an AttributeToken was returned from Next.
 func (l *Lexer) AttrVal() []byte {
 	return l.attrVal
@@ -325,6 +337,9 @@ func (l *Lexer) shiftStartTag() (TokenType, []byte) {
 	}
 	l.text = l.r.Lexeme()[1:]
 	if h := ToHash(l.text); h == Textarea || h == Title || h == Style || h == Xmp || h == Iframe || h == Script || h == Plaintext || h == Svg || h == Math {
+		if (h == Svg || h == Math) && l.noRawXml {
+			return StartTagToken, l.r.Shift()
+		}
 		if h == Svg || h == Math {
 			data := l.shiftXml(h)
 			if l.err != nil {
@@ -362,3 +362,34 @@ func ExampleNewLexer() {
 	fmt.Println(out)
 	// Output: <span class='user'>John Doe</span>
 }
+
+func TestDisableRawXml(t *testing.T) {
+	var tokenTests = []struct {
+		html     string
+		expected []TokenType
+	}{
+		{"<svg>text</svg>", TTs{StartTagToken, StartTagCloseToken, TextToken, EndTagToken}},
+		{`<svg viewBox="0 0 1 1"><path d="M0"/></svg>`, TTs{StartTagToken, AttributeToken, StartTagCloseToken, StartTagToken, AttributeToken, StartTagVoidToken, EndTagToken}},
+		{"<math><mi>x</mi></math>", TTs{StartTagToken, StartTagCloseToken, StartTagToken, StartTagCloseToken, TextToken, EndTagToken, EndTagToken}},
+	}
+	for _, tt := range tokenTests {
+		t.Run(tt.html, func(t *testing.T) {
+			l := NewLexer(parse.NewInputString(tt.html))
+			l.DisableRawXml()
+			i := 0
+			for {
+				token, _ := l.Next()
+				if token == ErrorToken {
+					test.T(t, l.Err(), io.EOF)
+					test.T(t, i, len(tt.expected), "when error occurred we must be at the end")
+					break
+				}
+				test.That(t, i < len(tt.expected), "index", i, "must not exceed expected token types size", len(tt.expected))
+				if i < len(tt.expected) {
+					test.T(t, token, tt.expected[i], "token types must match")
+				}
+				i++
+			}
+		})
+	}
+}
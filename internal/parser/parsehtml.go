@@ -31,11 +31,13 @@ type Node struct {
 	Attrs    []Attr
 	Parent   *Node
 	Child    []*Node
+	Pos      int // 节点在源码中的偏移量, TextNode是去掉首尾空白之后的偏移量
 }
 
 type Attr struct {
-	Key   string
-	Value string
+	Key    string
+	Value  string
+	ValPos int // 属性值(不包括引号)在源码中的偏移量
 }
 
 func (p *Node) AddChild(n *Node) {
@@ -184,6 +186,7 @@ func (p *NodeParser) Parse(l *html.Lexer) (node *Node, err error) {
 	currNode := rootNode
 
 	for {
+		pos := l.Offset()
 		tt, data := l.Next()
 		switch tt {
 		case html.ErrorToken:
@@ -192,6 +195,8 @@ func (p *NodeParser) Parse(l *html.Lexer) (node *Node, err error) {
 			if err != nil {
 				if err == io.EOF {
 					err = nil
+				} else {
+					err = NewError(l.Offset(), err)
 				}
 			}
 			return rootNode, err
@@ -202,6 +207,7 @@ func (p *NodeParser) Parse(l *html.Lexer) (node *Node, err error) {
 				Tag:      tag,
 				Attrs:    nil,
 				Child:    nil,
+				Pos:      pos,
 			}
 
 			currNode.Add(nn)
@@ -219,11 +225,15 @@ func (p *NodeParser) Parse(l *html.Lexer) (node *Node, err error) {
 				Text:     byte2str(data),
 				Attrs:    nil,
 				Child:    nil,
+				Pos:      pos,
 			}
 			currNode.Add(nn)
 			currNode = nn
 		case html.TextToken:
-			text := strings.Trim(byte2str(data), whitespace)
+			raw := byte2str(data)
+			text := strings.TrimLeft(raw, whitespace)
+			pos += len(raw) - len(text)
+			text = strings.TrimRight(text, whitespace)
 			if len(text) == 0 {
 				break
 			}
@@ -234,21 +244,28 @@ func (p *NodeParser) Parse(l *html.Lexer) (node *Node, err error) {
 				Text:     text,
 				Attrs:    nil,
 				Child:    nil,
+				Pos:      pos,
 			}
 			currNode.Add(nn)
 			currNode = nn
 		case html.AttributeToken:
-			// 删除引号
+			// 属性值在token的末尾
 			attrVal := byte2str(l.AttrVal())
+			valPos := l.Offset() - len(attrVal)
+
+			// 删除引号
 			if strings.HasPrefix(attrVal, `"`) && strings.HasSuffix(attrVal, `"`) {
 				attrVal = attrVal[1 : len(attrVal)-1]
+				valPos++
 			} else if strings.HasPrefix(attrVal, `'`) && strings.HasSuffix(attrVal, `'`) {
 				attrVal = attrVal[1 : len(attrVal)-1]
+				valPos++
 			}
 
 			currNode.Attrs = append(currNode.Attrs, Attr{
-				Key:   byte2str(l.Text()),
-				Value: attrVal,
+				Key:    byte2str(l.Text()),
+				Value:  attrVal,
+				ValPos: valPos,
 			})
 		case html.StartTagVoidToken:
 			currNode = currNode.Parent
@@ -259,6 +276,7 @@ func (p *NodeParser) Parse(l *html.Lexer) (node *Node, err error) {
 				Text:     byte2str(data),
 				Attrs:    nil,
 				Child:    nil,
+				Pos:      pos,
 			}
 			currNode.Add(nn)
 			currNode = nn
@@ -270,6 +288,8 @@ func (p *NodeParser) Parse(l *html.Lexer) (node *Node, err error) {
 
 func ParseHtml(str string) (nt *Node, err error) {
 	l := html.NewLexer(parse.NewInputString(str))
+	// svg中同样可以使用模板语法, 所以需要解析其子节点
+	l.DisableRawXml()
 	return NewNodeParser().Parse(l)
 }
 
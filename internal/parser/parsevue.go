@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/zbysir/vpl/internal/util"
+	"regexp"
 	"strings"
 )
 
@@ -13,6 +14,7 @@ type Prop struct {
 	Key       string
 	StaticVal interface{} // 静态的value, 如style和class在编译时就会被解析成map和slice
 	ValCode   string      // 如果props是动态的, valCode存储js表达式
+	Pos       int         // 属性值在源码中的偏移量
 }
 
 type Style struct {
@@ -132,16 +134,19 @@ type Directive struct {
 	Name  string // animate
 	Value string // {'a': 1}
 	Arg   string // v-set:arg
+	Pos   int    // Value在源码中的偏移量
 }
 
 type ElseIf struct {
 	Types      string // else / elseif
 	Condition  string // elseif语句的condition表达式
+	Pos        int    // Condition在源码中的偏移量
 	VueElement *VueElement
 }
 
 type VIf struct {
 	Condition string // 条件表达式
+	Pos       int    // Condition在源码中的偏移量
 	// 当此节点是if节点是, 将与if指令匹配的elseif/else节点关联在一起
 	ElseIf []*ElseIf
 }
@@ -153,7 +158,13 @@ func (p *VIf) AddElseIf(v *ElseIf) {
 type VFor struct {
 	ArrayKey string
 	ItemKey  string
+	// 遍历数组时是下标, 遍历对象时是key
 	IndexKey string
+	// (value, key, index) in object 中的index, 没有声明时为空
+	KeyIndexKey string
+	Pos         int // ArrayKey在源码中的偏移量
+	// 紧跟在v-for之后的v-else节点, 在列表为空时渲染
+	Else *VueElement
 }
 
 type VSlot struct {
@@ -162,12 +173,14 @@ type VSlot struct {
 }
 type VBind struct {
 	Val string
+	Pos int // Val在源码中的偏移量
 }
 
 type VueElement struct {
 	NodeType NodeType
 	Tag      string
 	Text     string
+	Pos      int // 节点在源码中的偏移量
 	// 是否分配调用组件时传递来的属性.
 	// 如果组件中只存在一个root节点, 则此节点会自动分配属性. 否则所有root节点都不会.
 	// (fragments: https://v3.vuejs.org/guide/migration/fragments.html#overview)
@@ -189,8 +202,20 @@ type VueElement struct {
 	// v-html / v-text
 	// 支持v-html / v-text指令覆盖子级内容的组件有: template / html基本标签
 	// component/slot和自定义组件不支持(没有必要)v-html/v-text覆盖子级
-	VHtml string
-	VText string
+	VHtml    string
+	VText    string
+	VHtmlPos int
+	VTextPos int
+	// v-memo / v-once, 缓存渲染结果
+	VMemo *VMemo
+}
+
+// v-memo="[a, b]": 依赖的值不变时复用上一次渲染的结果
+// v-once: Deps为空, 只渲染一次
+type VMemo struct {
+	Deps string
+	Pos  int
+	Once bool
 }
 
 type ParseVueNodeOptions struct {
@@ -211,7 +236,8 @@ func (p VueElementParser) Parse(e *Node) (*VueElement, error) {
 	ve := vs[0]
 
 	// 如果根节点只有要给并且是template，则是vue写法, 需要删除掉template来兼容此语法
-	if len(ve.Children) == 1 && ve.Children[0].Tag == "template" {
+	// 带有v-memo/v-once的template需要保留
+	if len(ve.Children) == 1 && ve.Children[0].Tag == "template" && ve.Children[0].VMemo == nil {
 		ve.Children = ve.Children[0].Children
 	}
 
@@ -248,6 +274,8 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 	vs := make([]*VueElement, 0)
 
 	var ifVueEle *VueElement
+	// v-for节点, 接下来的v-else将作为列表为空时的内容
+	var forVueEle *VueElement
 	for _, e := range es {
 		if p.options.SkipComment {
 			if e.NodeType == CommentNode {
@@ -272,6 +300,10 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 		// v-html与v-text表达式
 		var vHtml string
 		var vText string
+		var vHtmlPos int
+		var vTextPos int
+
+		var vMemo *VMemo
 
 		for _, attr := range e.Attrs {
 			oriKey := attr.Key
@@ -293,6 +325,7 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 						CanBeAttr: true,
 						Key:       "class",
 						ValCode:   attr.Value,
+						Pos:       attr.ValPos,
 					})
 				} else if key == "style" {
 					props = append(props, &Prop{
@@ -300,6 +333,7 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 						CanBeAttr: true,
 						Key:       "style",
 						ValCode:   attr.Value,
+						Pos:       attr.ValPos,
 					})
 				} else {
 					// 动态prosp
@@ -308,6 +342,7 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 						CanBeAttr: p.options.CanBeAttr(key),
 						Key:       key,
 						ValCode:   attr.Value,
+						Pos:       attr.ValPos,
 					})
 				}
 			} else if strings.HasPrefix(oriKey, "v-") {
@@ -324,37 +359,18 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 				case key == "v-bind":
 					vBind = &VBind{
 						Val: attr.Value,
+						Pos: attr.ValPos,
 					}
 				case key == "v-for":
-					val := attr.Value
-
-					ss := strings.Split(val, " in ")
-					arrayKey := strings.Trim(ss[1], " ")
-
-					left := strings.Trim(ss[0], " ")
-					var itemKey string
-					var indexKey string
-					// (item, index) in list
-					if strings.Contains(left, ",") {
-						left = strings.Trim(left, "()")
-						ss := strings.Split(left, ",")
-						itemKey = strings.Trim(ss[0], " ")
-						indexKey = strings.Trim(ss[1], " ")
-					} else {
-						// (item) or item
-						left = strings.Trim(left, "()")
-						itemKey = left
-						indexKey = "$index"
-					}
-
-					vFor = &VFor{
-						ArrayKey: arrayKey,
-						ItemKey:  itemKey,
-						IndexKey: indexKey,
+					vFor, err = parseVFor(attr.Value, attr.ValPos)
+					if err != nil {
+						return
 					}
 				case key == "v-if":
+					condition, pos := trimPos(attr.Value, attr.ValPos)
 					vIf = &VIf{
-						Condition: strings.Trim(attr.Value, " "),
+						Condition: condition,
+						Pos:       pos,
 						ElseIf:    nil,
 					}
 				case nameSpace == "v-slot":
@@ -366,19 +382,34 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 						PropsKey: propsKey,
 					}
 				case key == "v-else-if":
+					condition, pos := trimPos(attr.Value, attr.ValPos)
 					vElseIf = &ElseIf{
 						Types:     "elseif",
-						Condition: strings.Trim(attr.Value, " "),
+						Condition: condition,
+						Pos:       pos,
 					}
 				case key == "v-else":
+					condition, pos := trimPos(attr.Value, attr.ValPos)
 					vElse = &ElseIf{
 						Types:     "else",
-						Condition: strings.Trim(attr.Value, " "),
+						Condition: condition,
+						Pos:       pos,
 					}
 				case key == "v-html":
-					vHtml = strings.Trim(attr.Value, " ")
+					vHtml, vHtmlPos = trimPos(attr.Value, attr.ValPos)
 				case key == "v-text":
-					vText = strings.Trim(attr.Value, " ")
+					vText, vTextPos = trimPos(attr.Value, attr.ValPos)
+				case key == "v-memo", key == "v-once":
+					if vMemo != nil {
+						err = NewError(attr.ValPos, errors.New("v-memo and v-once can not be used together"))
+						return
+					}
+					deps, pos := trimPos(attr.Value, attr.ValPos)
+					if key == "v-memo" && deps == "" {
+						err = NewError(attr.ValPos, errors.New("v-memo: missing dependencies"))
+						return
+					}
+					vMemo = &VMemo{Deps: deps, Pos: pos, Once: key == "v-once"}
 				default:
 					// 自定义指令
 					var name string
@@ -389,10 +420,12 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 					} else {
 						name = key
 					}
+					value, pos := trimPos(attr.Value, attr.ValPos)
 					ds = append(ds, Directive{
 						Name:  strings.TrimPrefix(name, "v-"),
-						Value: strings.Trim(attr.Value, " "),
+						Value: value,
 						Arg:   arg,
+						Pos:   pos,
 					})
 				}
 			} else if strings.HasPrefix(key, "#") {
@@ -456,6 +489,12 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 			}
 		}
 
+		// v-once在v-for中的每一次循环分别缓存, 与v-for在同一个节点上时含义不明确(缓存整个列表还是每一项)
+		if vMemo != nil && vMemo.Once && vFor != nil {
+			err = NewError(vMemo.Pos, errors.New("v-once can not be used with v-for on the same element, move it to a wrapping element"))
+			return
+		}
+
 		ch, er := p.parseList(e.Child)
 		if er != nil {
 			err = er
@@ -466,6 +505,7 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 			NodeType: e.NodeType,
 			Tag:      e.Tag,
 			Text:     e.Text,
+			Pos:      e.Pos,
 			//PropClass:  propClass,
 			//PropStyle:  propStyle,
 			Props:      props,
@@ -480,7 +520,10 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 			VElseIf:  vElseIf != nil,
 			VHtml:    vHtml,
 			VText:    vText,
+			VHtmlPos: vHtmlPos,
+			VTextPos: vTextPos,
 			VBind:    vBind,
+			VMemo:    vMemo,
 		}
 
 		// 记录vif, 接下来的elseif将与这个节点关联
@@ -493,10 +536,21 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 				ifVueEle = nil
 			}
 		}
+		// 同时有v-for与v-if时, v-else属于v-if
+		if vFor != nil && vIf == nil {
+			forVueEle = v
+		} else if e.NodeType != CommentNode {
+			if vElse != nil && forVueEle != nil {
+				forVueEle.VFor.Else = v
+				forVueEle = nil
+				continue
+			}
+			forVueEle = nil
+		}
 
 		if vElseIf != nil {
 			if ifVueEle == nil {
-				err = errors.New("v-else-if must below v-if")
+				err = NewError(e.Pos, errors.New("v-else-if must below v-if"))
 				return
 			}
 			vElseIf.VueElement = v
@@ -507,7 +561,7 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 		}
 		if vElse != nil {
 			if ifVueEle == nil {
-				err = errors.New("v-else must below v-if")
+				err = NewError(e.Pos, errors.New("v-else must below v-if or v-for"))
 				return
 			}
 			vElse.VueElement = v
@@ -522,6 +576,56 @@ func (p VueElementParser) parseList(es []*Node) (ve []*VueElement, err error) {
 	return vs, nil
 }
 
+var vForRe = regexp.MustCompile(`^\s*([\s\S]*?)\s+(?:in|of)\s+([\s\S]*?)\s*$`)
+var identifierRe = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+
+// 解析v-for, 支持:
+//
+//	item in list / item of list
+//	(item, index) in list
+//	(value, key, index) in object
+//	n in 10
+func parseVFor(val string, pos int) (*VFor, error) {
+	m := vForRe.FindStringSubmatchIndex(val)
+	if m == nil || m[5] == m[4] {
+		return nil, NewError(pos, fmt.Errorf("invalid v-for expression %q, want \"item in list\"", val))
+	}
+	left := strings.TrimSpace(val[m[2]:m[3]])
+	if strings.HasPrefix(left, "(") && strings.HasSuffix(left, ")") {
+		left = left[1 : len(left)-1]
+	}
+	aliases := strings.Split(left, ",")
+	if len(aliases) > 3 {
+		return nil, NewError(pos, fmt.Errorf("invalid v-for alias %q, want \"(value, key, index)\"", left))
+	}
+	for i, a := range aliases {
+		aliases[i] = strings.TrimSpace(a)
+		if !identifierRe.MatchString(aliases[i]) {
+			return nil, NewError(pos, fmt.Errorf("invalid v-for alias %q", left))
+		}
+	}
+
+	vFor := &VFor{
+		ArrayKey: val[m[4]:m[5]],
+		ItemKey:  aliases[0],
+		IndexKey: "$index",
+		Pos:      pos + m[4],
+	}
+	if len(aliases) > 1 {
+		vFor.IndexKey = aliases[1]
+	}
+	if len(aliases) > 2 {
+		vFor.KeyIndexKey = aliases[2]
+	}
+	return vFor, nil
+}
+
+// 去掉首尾空格, 并返回去掉空格之后在源码中的偏移量
+func trimPos(s string, pos int) (string, int) {
+	t := strings.TrimLeft(s, " ")
+	return strings.TrimRight(t, " "), pos + len(s) - len(t)
+}
+
 // 将html节点转换为Vue节点
 func ToVueNode(node *Node, options *ParseVueNodeOptions) (vn *VueElement, err error) {
 	if options == nil {
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Source 是模板源码, 用于将偏移量转换为行列号
+type Source struct {
+	Name string // 文件名或者组件名
+	Text string
+}
+
+// Position 是源码中的位置
+type Position struct {
+	Filename string
+	Line     int // 从1开始
+	Column   int // 从1开始, 按字符计算
+}
+
+func (p Position) String() string {
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// Position 返回偏移量对应的行列号
+func (s *Source) Position(offset int) Position {
+	if offset > len(s.Text) {
+		offset = len(s.Text)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	lineStart := strings.LastIndexByte(s.Text[:offset], '\n') + 1
+	return Position{
+		Filename: s.Name,
+		Line:     strings.Count(s.Text[:offset], "\n") + 1,
+		Column:   utf8.RuneCountInString(s.Text[lineStart:offset]) + 1,
+	}
+}
+
+// Snippet 返回偏移量所在的行, 并在下一行用^标记出位置, 如:
+//
+//	3 | <p>{{ (x }}</p>
+//	  |       ^
+func (s *Source) Snippet(offset int) string {
+	if offset > len(s.Text) {
+		offset = len(s.Text)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	lineStart := strings.LastIndexByte(s.Text[:offset], '\n') + 1
+	lineEnd := strings.IndexByte(s.Text[offset:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(s.Text)
+	} else {
+		lineEnd += offset
+	}
+	line := strings.TrimRight(s.Text[lineStart:lineEnd], "\r")
+
+	// 保留tab, 宽字符(如中文)占两列, 让^能和上一行对齐
+	var marker strings.Builder
+	for _, r := range s.Text[lineStart:offset] {
+		switch {
+		case r == '\t':
+			marker.WriteByte('\t')
+		case isWide(r):
+			marker.WriteString("  ")
+		default:
+			marker.WriteByte(' ')
+		}
+	}
+	marker.WriteByte('^')
+
+	lineNo := fmt.Sprintf("%d", strings.Count(s.Text[:offset], "\n")+1)
+	pad := strings.Repeat(" ", len(lineNo))
+	return fmt.Sprintf("%s | %s\n%s | %s", lineNo, line, pad, marker.String())
+}
+
+// 在终端中占两列的字符, 包括中日韩文字, 全角符号与常见的emoji
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},
+	{0x2E80, 0x303E},
+	{0x3041, 0x33FF},
+	{0x3400, 0x4DBF},
+	{0x4E00, 0x9FFF},
+	{0xA000, 0xA4CF},
+	{0xAC00, 0xD7A3},
+	{0xF900, 0xFAFF},
+	{0xFE30, 0xFE4F},
+	{0xFF00, 0xFF60},
+	{0xFFE0, 0xFFE6},
+	{0x1F300, 0x1F64F},
+	{0x1F900, 0x1F9FF},
+	{0x20000, 0x3FFFD},
+}
+
+func isWide(r rune) bool {
+	if r < 0x1100 {
+		return false
+	}
+	for _, w := range wideRanges {
+		if r >= w[0] && r <= w[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Locate 计算err中的*Error的行列号与代码片段
+func (s *Source) Locate(err error) error {
+	var e *Error
+	if errors.As(err, &e) && e.Pos.Line == 0 {
+		e.Pos = s.Position(e.Offset)
+		e.Snippet = s.Snippet(e.Offset)
+	}
+	return err
+}
+
+// Error 是带有位置信息的错误
+// 在解析阶段只会记录Offset, 需要调用Source.Locate计算出行列号
+type Error struct {
+	Offset  int      // 在源码中的偏移量
+	Pos     Position // 行列号
+	Snippet string   // 出错的代码行
+	Err     error
+}
+
+func NewError(offset int, err error) *Error {
+	return &Error{Offset: offset, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Pos.Line == 0 {
+		return fmt.Sprintf("offset %d: %v", e.Offset, e.Err)
+	}
+	if e.Snippet == "" {
+		return fmt.Sprintf("%s: %v", e.Pos, e.Err)
+	}
+	return fmt.Sprintf("%s: %v\n%s", e.Pos, e.Err, e.Snippet)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippet(t *testing.T) {
+	cases := []struct {
+		Name string
+		Text string
+		// 出错的位置
+		At   string
+		Want string
+	}{
+		{
+			Name: "ascii",
+			Text: "<div>\n<p>{{ (x }}</p>",
+			At:   "}}</p>",
+			Want: "2 | <p>{{ (x }}</p>\n  |          ^",
+		},
+		{
+			Name: "tab",
+			Text: "<div>\n\t<p>{{ (x }}</p>",
+			At:   "}}</p>",
+			Want: "2 | \t<p>{{ (x }}</p>\n  | \t         ^",
+		},
+		{
+			Name: "chinese",
+			Text: "<p>名字：{{ (x }}</p>",
+			At:   "}}</p>",
+			Want: "1 | <p>名字：{{ (x }}</p>\n  |                ^",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			s := &Source{Text: c.Text}
+			get := s.Snippet(strings.Index(c.Text, c.At))
+			if get != c.Want {
+				t.Fatalf("want:\n%s\nget:\n%s", c.Want, get)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// ConvertTo 将模板中的值(float64/int64/string/[]interface{}/map[string]interface{}等)转换为类型t, 用于调用go中的方法.
+// 数字与字符串之间会互相转换, slice与map会逐个转换元素, map[string]interface{}可以转换为struct(字段名与读取时的规则相同).
+func ConvertTo(v interface{}, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(t) {
+		r := reflect.New(t).Elem()
+		r.Set(rv)
+		return r, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, err := toFloat(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if f != math.Trunc(f) {
+			return reflect.Value{}, fmt.Errorf("cannot convert %v to %s", v, t)
+		}
+		r := reflect.New(t).Elem()
+		if r.OverflowInt(int64(f)) {
+			return reflect.Value{}, fmt.Errorf("%v overflows %s", v, t)
+		}
+		r.SetInt(int64(f))
+		return r, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f, err := toFloat(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if f != math.Trunc(f) || f < 0 {
+			return reflect.Value{}, fmt.Errorf("cannot convert %v to %s", v, t)
+		}
+		r := reflect.New(t).Elem()
+		if r.OverflowUint(uint64(f)) {
+			return reflect.Value{}, fmt.Errorf("%v overflows %s", v, t)
+		}
+		r.SetUint(uint64(f))
+		return r, nil
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		r := reflect.New(t).Elem()
+		r.SetFloat(f)
+		return r, nil
+	case reflect.String:
+		r := reflect.New(t).Elem()
+		if s, ok := v.(string); ok {
+			r.SetString(s)
+			return r, nil
+		}
+		if rv.Kind() == reflect.String {
+			r.SetString(rv.String())
+			return r, nil
+		}
+		if _, ok := ReflectNumber(v); ok {
+			r.SetString(InterfaceToStr(v))
+			return r, nil
+		}
+	case reflect.Bool:
+		r := reflect.New(t).Elem()
+		r.SetBool(InterfaceToBool(v))
+		return r, nil
+	case reflect.Slice:
+		src, ok := Indirect(rv)
+		if !ok || (src.Kind() != reflect.Slice && src.Kind() != reflect.Array) {
+			break
+		}
+		r := reflect.MakeSlice(t, src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			e, err := ConvertTo(src.Index(i).Interface(), t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("[%d]: %w", i, err)
+			}
+			r.Index(i).Set(e)
+		}
+		return r, nil
+	case reflect.Array:
+		src, ok := Indirect(rv)
+		if !ok || (src.Kind() != reflect.Slice && src.Kind() != reflect.Array) || src.Len() > t.Len() {
+			break
+		}
+		r := reflect.New(t).Elem()
+		for i := 0; i < src.Len(); i++ {
+			e, err := ConvertTo(src.Index(i).Interface(), t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("[%d]: %w", i, err)
+			}
+			r.Index(i).Set(e)
+		}
+		return r, nil
+	case reflect.Map:
+		src, ok := Indirect(rv)
+		if !ok || src.Kind() != reflect.Map || t.Key().Kind() != reflect.String || src.Type().Key().Kind() != reflect.String {
+			break
+		}
+		r := reflect.MakeMapWithSize(t, src.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			e, err := ConvertTo(iter.Value().Interface(), t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("[%s]: %w", k, err)
+			}
+			r.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), e)
+		}
+		return r, nil
+	case reflect.Struct:
+		src, ok := Indirect(rv)
+		if !ok || src.Kind() != reflect.Map || src.Type().Key().Kind() != reflect.String {
+			break
+		}
+		r := reflect.New(t).Elem()
+		fields := getStructFields(t)
+		iter := src.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			index, ok := fields[k]
+			if !ok {
+				continue
+			}
+			f, ok := fieldByIndexAlloc(r, index)
+			if !ok {
+				continue
+			}
+			e, err := ConvertTo(iter.Value().Interface(), f.Type())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("%s: %w", k, err)
+			}
+			f.Set(e)
+		}
+		return r, nil
+	case reflect.Ptr:
+		e, err := ConvertTo(v, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(e)
+		return p, nil
+	}
+
+	if rv.Type().ConvertibleTo(t) && rv.Kind() == t.Kind() {
+		return rv.Convert(t), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot convert %T to %s", v, t)
+}
+
+// 按索引获取可写的字段, 经过的nil指针会被初始化; 不可写的字段(如未导出的嵌套struct)返回false
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, v.CanSet()
+}
+
+func toFloat(v interface{}) (float64, error) {
+	if f, ok := ReflectNumber(v); ok {
+		return f, nil
+	}
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot convert %q to number", s)
+		}
+		return f, nil
+	}
+	if b, ok := v.(bool); ok {
+		if b {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to number", v)
+}
@@ -0,0 +1,178 @@
+package util
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 通过反射读取go中的struct/map/slice等类型, 不再需要使用vpl.Copy将数据转为map[string]interface{}.
+// struct的字段信息会按类型缓存, 只在第一次访问时解析.
+
+// struct字段的索引, 用于reflect.Value.Field
+type structFields map[string][]int
+
+var structFieldsCache sync.Map // map[reflect.Type]structFields
+
+func getStructFields(t reflect.Type) structFields {
+	if f, ok := structFieldsCache.Load(t); ok {
+		return f.(structFields)
+	}
+
+	fields := structFields{}
+	collectStructFields(t, nil, fields, map[reflect.Type]bool{})
+	f, _ := structFieldsCache.LoadOrStore(t, fields)
+	return f.(structFields)
+}
+
+// 收集struct中可导出的字段, 字段名优先使用json tag.
+// 匿名嵌套的struct的字段会被提升, 但不会覆盖外层的同名字段.
+func collectStructFields(t reflect.Type, index []int, fields structFields, visited map[reflect.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+		f.Index = idx
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		if comma := strings.Index(tag, ","); comma != -1 {
+			name = tag[:comma]
+		}
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, f)
+				continue
+			}
+		}
+		// 未导出的字段
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		if _, exist := fields[name]; !exist {
+			fields[name] = idx
+		}
+	}
+
+	// 嵌套的字段优先级更低, 所以最后处理
+	for _, f := range embedded {
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		collectStructFields(ft, f.Index, fields, visited)
+	}
+}
+
+// 按索引读取字段, 如果经过的嵌套指针为nil则返回false
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// Indirect 解开指针与interface, 如果为nil则返回false
+func Indirect(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, v.IsValid()
+}
+
+// LookupReflect 使用反射读取data中的key
+// 支持 struct(及其指针)的字段, key为string类型的map, slice/array的下标与length
+func LookupReflect(data interface{}, key string) (interface{}, bool) {
+	if data == nil {
+		return nil, false
+	}
+	v, ok := Indirect(reflect.ValueOf(data))
+	if !ok {
+		return nil, false
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		index, ok := getStructFields(v.Type())[key]
+		if !ok {
+			return nil, false
+		}
+		f, ok := fieldByIndex(v, index)
+		if !ok {
+			return nil, false
+		}
+		return f.Interface(), true
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		r := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		if !r.IsValid() {
+			return nil, false
+		}
+		return r.Interface(), true
+	case reflect.Slice, reflect.Array:
+		if key == "length" {
+			return v.Len(), true
+		}
+		index, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		if int(index) >= v.Len() || index < 0 {
+			return nil, false
+		}
+		return v.Index(int(index)).Interface(), true
+	case reflect.String:
+		if key == "length" {
+			return v.Len(), true
+		}
+	}
+
+	return nil, false
+}
+
+// ReflectNumber 将自定义的数字类型(如 type Status int)转为float64
+func ReflectNumber(s interface{}) (float64, bool) {
+	v := reflect.ValueOf(s)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
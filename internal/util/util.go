@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -140,59 +141,220 @@ func InterfaceToBool(s interface{}) (d bool) {
 	case string:
 		return a != "" && a != "false" && a != "0"
 	default:
-		return true
+		return reflectToBool(reflect.ValueOf(s))
 	}
 }
 
-func ForInterface(s interface{}, cb func(index int, v interface{}) error) error {
+// go中的其他类型: nil的指针/map/slice/func/chan为false, 自定义的数字与bool类型按值判断
+func reflectToBool(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return !v.IsNil()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() != 0
+	}
+	return true
+}
+
+// ForInterface 遍历s, 支持:
+//   - slice/array: key为下标
+//   - map: 按key排序后遍历, key为map的key
+//   - 整数n: 遍历1~n, key为下标
+//   - string: 遍历每个字符
+//   - chan: 遍历直到chan关闭或者done关闭
+//
+// nil不会遍历, 其他类型返回错误.
+func ForInterface(s interface{}, done <-chan struct{}, cb func(index int, key interface{}, v interface{}) error) error {
 	switch a := s.(type) {
 	case []interface{}:
 		for i := range a {
-			if err := cb(i, a[i]); err != nil {
+			if err := cb(i, i, a[i]); err != nil {
 				return err
 			}
 		}
 	case []map[string]interface{}:
 		for i := range a {
-			if err := cb(i, a[i]); err != nil {
+			if err := cb(i, i, a[i]); err != nil {
 				return err
 			}
 		}
 	case []int:
 		for i := range a {
-			if err := cb(i, a[i]); err != nil {
+			if err := cb(i, i, a[i]); err != nil {
 				return err
 			}
 		}
 	case []int64:
 		for i := range a {
-			if err := cb(i, a[i]); err != nil {
+			if err := cb(i, i, a[i]); err != nil {
 				return err
 			}
 		}
 	case []int32:
 		for i := range a {
-			if err := cb(i, a[i]); err != nil {
+			if err := cb(i, i, a[i]); err != nil {
 				return err
 			}
 		}
 	case []string:
 		for i := range a {
-			if err := cb(i, a[i]); err != nil {
+			if err := cb(i, i, a[i]); err != nil {
 				return err
 			}
 		}
 	case []float64:
 		for i := range a {
-			if err := cb(i, a[i]); err != nil {
+			if err := cb(i, i, a[i]); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(a))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			if err := cb(i, k, a[k]); err != nil {
 				return err
 			}
 		}
+	case string:
+		i := 0
+		for _, r := range a {
+			if err := cb(i, i, string(r)); err != nil {
+				return err
+			}
+			i++
+		}
+	case nil:
+	default:
+		// 其他类型的slice/array/map/chan(及其指针)
+		v, ok := Indirect(reflect.ValueOf(s))
+		if !ok {
+			return nil
+		}
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				if err := cb(i, i, v.Index(i).Interface()); err != nil {
+					return err
+				}
+			}
+		case reflect.Map:
+			keys := v.MapKeys()
+			sortValues(keys)
+			for i, k := range keys {
+				if err := cb(i, k.Interface(), v.MapIndex(k).Interface()); err != nil {
+					return err
+				}
+			}
+		case reflect.Chan:
+			return forChan(v, done, cb)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return forRange(v.Int(), cb)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return forRange(int64(v.Uint()), cb)
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			if f != float64(int64(f)) {
+				return fmt.Errorf("invalid range %v, want an integer", f)
+			}
+			return forRange(int64(f), cb)
+		default:
+			return fmt.Errorf("cannot range over %T", s)
+		}
+	}
+
+	return nil
+}
+
+// ForLen 返回ForInterface会遍历的次数, 无法预知时(chan)返回-1
+func ForLen(s interface{}) int {
+	switch a := s.(type) {
+	case []interface{}:
+		return len(a)
+	case map[string]interface{}:
+		return len(a)
+	case string:
+		return utf8.RuneCountInString(a)
+	case nil:
+		return 0
 	}
 
+	v, ok := Indirect(reflect.ValueOf(s))
+	if !ok {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return int(v.Float())
+	}
+	return -1
+}
+
+// 遍历1~n
+func forRange(n int64, cb func(index int, key interface{}, v interface{}) error) error {
+	if n < 0 {
+		return fmt.Errorf("invalid range %d, want a non-negative integer", n)
+	}
+	for i := 0; i < int(n); i++ {
+		if err := cb(i, i, i+1); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func forChan(v reflect.Value, done <-chan struct{}, cb func(index int, key interface{}, v interface{}) error) error {
+	if v.Type().ChanDir()&reflect.RecvDir == 0 {
+		return fmt.Errorf("cannot range over send-only channel %s", v.Type())
+	}
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: v}}
+	if done != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+	}
+	for i := 0; ; i++ {
+		chosen, x, ok := reflect.Select(cases)
+		if chosen != 0 || !ok {
+			return nil
+		}
+		if err := cb(i, i, x.Interface()); err != nil {
+			return err
+		}
+	}
+}
+
+// 排序map的key, 让遍历的顺序稳定
+func sortValues(vs []reflect.Value) {
+	sort.Slice(vs, func(i, j int) bool {
+		a, b := vs[i], vs[j]
+		switch a.Kind() {
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		}
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	})
+}
+
 func Interface2Slice(s interface{}) (d []interface{}) {
 
 	return
@@ -1,13 +1,16 @@
 package vpl
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
 
 	"github.com/robertkrimen/otto/ast"
 	"github.com/robertkrimen/otto/parser"
 	"github.com/robertkrimen/otto/token"
+	"github.com/zbysir/vpl/internal/util"
 )
 
 func compileJS(code string) (node ast.Node, err error) {
@@ -22,11 +25,35 @@ func compileJS(code string) (node ast.Node, err error) {
 	return p.Body[0], nil
 }
 
+// 成员表达式的路径, 用于严格模式下的错误信息, 如 user.name, list[i]
+func memberPath(node ast.Node) string {
+	switch t := node.(type) {
+	case *ast.Identifier:
+		return t.Name
+	case *ast.DotExpression:
+		return memberPath(t.Left) + "." + t.Identifier.Name
+	case *ast.BracketExpression:
+		return memberPath(t.Left) + "[" + memberPath(t.Member) + "]"
+	case *ast.StringLiteral:
+		return t.Literal
+	case *ast.NumberLiteral:
+		return t.Literal
+	}
+	return "..."
+}
+
 func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 	switch t := node.(type) {
 	case *ast.ExpressionStatement:
 		return runJsExpression(t.Expression, ctx)
 	case *ast.Identifier:
+		if ctx.strict && t.Name != "undefined" {
+			v, exist := ctx.Scope.Lookup(t.Name)
+			if !exist {
+				return nil, fmt.Errorf("%w: %s", ErrUndefinedVariable, t.Name)
+			}
+			return v, nil
+		}
 		return ctx.Scope.Get(t.Name), nil
 	case *ast.DotExpression:
 		// a.b
@@ -35,7 +62,10 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 			return nil, err
 		}
 
-		r, _, _ := ShouldLookInterface(left, t.Identifier.Name)
+		r, _, exist := ShouldLookInterface(left, t.Identifier.Name)
+		if ctx.strict && !exist {
+			return nil, fmt.Errorf("%w: %s", ErrUndefinedVariable, memberPath(t))
+		}
 		return r, nil
 	case *ast.BracketExpression:
 		// a[b]
@@ -59,7 +89,10 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 			key = interfaceToStr(v)
 		}
 
-		r, _, _ := ShouldLookInterface(left, key)
+		r, _, exist := ShouldLookInterface(left, key)
+		if ctx.strict && !exist {
+			return nil, fmt.Errorf("%w: %s", ErrUndefinedVariable, memberPath(t))
+		}
 		return r, nil
 	case *ast.StringLiteral:
 		return t.Value, nil
@@ -74,6 +107,22 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 		if err != nil {
 			return nil, err
 		}
+
+		// 逻辑运算符需要短路求值, 并且和js一样返回操作数本身而不是bool
+		// 如 `fn && fn()` 在fn不存在时不会调用fn, `name || 'default'` 会返回name或者'default'
+		switch t.Operator {
+		case token.LOGICAL_AND:
+			if !interfaceToBool(left) {
+				return left, nil
+			}
+			return runJsExpression(t.Right, ctx)
+		case token.LOGICAL_OR:
+			if interfaceToBool(left) {
+				return left, nil
+			}
+			return runJsExpression(t.Right, ctx)
+		}
+
 		right, err := runJsExpression(t.Right, ctx)
 		if err != nil {
 			return nil, err
@@ -81,9 +130,9 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 		o := t.Operator
 		switch o {
 		case token.STRICT_EQUAL, token.EQUAL:
-			return left == right, nil
+			return interfaceEqual(left, right), nil
 		case token.NOT_EQUAL, token.STRICT_NOT_EQUAL:
-			return left != right, nil
+			return !interfaceEqual(left, right), nil
 		case token.PLUS:
 			return interfaceAdd(left, right), nil
 		case token.MINUS:
@@ -92,10 +141,6 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 			return interfaceToFloat(left) * interfaceToFloat(right), nil
 		case token.SLASH:
 			return interfaceToFloat(left) / interfaceToFloat(right), nil
-		case token.LOGICAL_AND:
-			return interfaceToBool(left) && interfaceToBool(right), nil
-		case token.LOGICAL_OR:
-			return interfaceToBool(left) || interfaceToBool(right), nil
 		case token.LESS:
 			return interfaceLess(left, right), nil
 		case token.GREATER:
@@ -106,7 +151,7 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 			return interfaceGreaterOrEqual(left, right), nil
 
 		default:
-			panic(fmt.Sprintf("bad Operator for BinaryExpression: %s", o))
+			return nil, fmt.Errorf("unsupported operator for BinaryExpression: %s", o)
 		}
 
 	case *ast.UnaryExpression:
@@ -124,7 +169,7 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 			// -1
 			return -interfaceToFloat(arg), nil
 		default:
-			panic(fmt.Sprintf("not handle UnaryExpression: %s", t.Operator))
+			return nil, fmt.Errorf("unsupported operator for UnaryExpression: %s", t.Operator)
 		}
 	case *ast.ObjectLiteral:
 		if len(t.Value) == 0 {
@@ -140,7 +185,7 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 			case "value":
 				k = v.Key
 			default:
-				panic(fmt.Sprintf("bad Value kind of ObjectLiteral: %v", v.Kind))
+				return nil, fmt.Errorf("unsupported value kind of ObjectLiteral: %v", v.Kind)
 			}
 
 			val, err := runJsExpression(v.Value, ctx)
@@ -152,9 +197,25 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 		return mp, nil
 	case *ast.CallExpression:
 		// fun(1,2,3, ...)
-		funcName, err := runJsExpression(t.Callee, ctx)
-		if err != nil {
-			return nil, err
+		var funcName interface{}
+		var method reflect.Value
+		if dot, ok := t.Callee.(*ast.DotExpression); ok {
+			// a.b(): 如果a是go中的值并且有允许调用的导出方法b(见WithMethods), 则调用这个方法, 否则读取a.b属性作为方法
+			left, err := runJsExpression(dot.Left, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if ctx.methods != nil {
+				method = lookupMethod(left, dot.Identifier.Name, ctx.methods)
+			}
+			if !method.IsValid() {
+				funcName, _, _ = ShouldLookInterface(left, dot.Identifier.Name)
+			}
+		} else {
+			funcName, err = runJsExpression(t.Callee, ctx)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		args := make([]interface{}, len(t.ArgumentList))
@@ -164,7 +225,14 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 				return nil, err
 			}
 		}
-		return interfaceToFunc(funcName)(ctx, args...), nil
+		if method.IsValid() {
+			r, err := callReflect(method, nil, args)
+			if err != nil {
+				return nil, fmt.Errorf("call method %s: %w", t.Callee.(*ast.DotExpression).Identifier.Name, err)
+			}
+			return r, nil
+		}
+		return callFunc(funcName, ctx, args)
 	case *ast.ArrayLiteral:
 		args := make([]interface{}, len(t.Value))
 		for i, v := range t.Value {
@@ -175,32 +243,21 @@ func runJsExpression(node ast.Node, ctx *RenderCtx) (r interface{}, err error) {
 		}
 		return args, nil
 	case *ast.ConditionalExpression:
-		// 三元运算
-		consequent, err := runJsExpression(t.Consequent, ctx)
-		if err != nil {
-			return nil, err
-		}
-		alternate, err := runJsExpression(t.Alternate, ctx)
-		if err != nil {
-			return nil, err
-		}
+		// 三元运算, 只执行满足条件的分支
 		test, err := runJsExpression(t.Test, ctx)
 		if err != nil {
 			return nil, err
 		}
 
 		if interfaceToBool(test) {
-			return consequent, err
+			return runJsExpression(t.Consequent, ctx)
 		} else {
-			return alternate, err
+			return runJsExpression(t.Alternate, ctx)
 		}
 
 	default:
-		panic(fmt.Sprintf("bad type %T for runJsExpression", t))
-		//bs, _ := json.Marshal(t)
-		//log.Panicf("%s", bs)
+		return nil, fmt.Errorf("unsupported expression: %T", t)
 	}
-	return
 }
 
 func isNumber(s interface{}) (d float64, is bool) {
@@ -219,7 +276,7 @@ func isNumber(s interface{}) (d float64, is bool) {
 	case float32:
 		return float64(a), true
 	default:
-		return 0, false
+		return util.ReflectNumber(s)
 	}
 }
 
@@ -284,7 +341,8 @@ func interfaceToBool(s interface{}) (d bool) {
 	case string:
 		return a != "" && a != "false" && a != "0"
 	default:
-		return true
+		// nil指针等go中的类型
+		return util.InterfaceToBool(s)
 	}
 }
 
@@ -308,8 +366,38 @@ func interfaceToFloat(s interface{}) (d float64) {
 	case float64:
 		return a
 	default:
-		return 0
+		d, _ = util.ReflectNumber(s)
+		return d
+	}
+}
+
+// 数字按值比较(如 int(2) == float64(2)),
+// 不可比较的类型(如slice/map)和js中的对象一样按引用比较
+func interfaceEqual(a, b interface{}) bool {
+	if an, ok := isNumber(a); ok {
+		if bn, ok := isNumber(b); ok {
+			return an == bn
+		}
+		return false
 	}
+	if a == nil || b == nil {
+		return a == b
+	}
+	at, bt := reflect.TypeOf(a), reflect.TypeOf(b)
+	if at != bt {
+		return false
+	}
+	if at.Comparable() {
+		return a == b
+	}
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch av.Kind() {
+	case reflect.Map, reflect.Func:
+		return av.Pointer() == bv.Pointer()
+	case reflect.Slice:
+		return av.Pointer() == bv.Pointer() && av.Len() == bv.Len()
+	}
+	return false
 }
 
 func interfaceLess(a, b interface{}) interface{} {
@@ -365,22 +453,196 @@ func interfaceGreaterOrEqual(a, b interface{}) interface{} {
 }
 
 // 用于{{func(a)}}语法
-func interfaceToFunc(s interface{}) (d Function) {
+func interfaceToFunc(s interface{}) (d Function, err error) {
 	if s == nil {
-		return emptyFunc
+		return emptyFunc, nil
 	}
 
 	switch a := s.(type) {
 	case func(*RenderCtx, ...interface{}) interface{}:
-		return a
+		return a, nil
 	case Function:
-		return a
+		return a, nil
 	default:
-		panic(fmt.Sprintf("bad Type of func: %T", a))
-		return emptyFunc
+		return nil, fmt.Errorf("bad Type of func: %T", a)
 	}
 }
 
+// 调用方法, 方法中的panic会被转为error返回
+func callFunc(f interface{}, ctx *RenderCtx, args []interface{}) (r interface{}, err error) {
+	// 通过Vpl.Func注册的方法
+	if rf, ok := f.(*reflectFunc); ok {
+		return rf.call(ctx, args)
+	}
+	// 其他任意的go方法, 如struct中方法类型的字段
+	if f != nil && reflect.TypeOf(f).Kind() == reflect.Func {
+		if _, ok := f.(Function); !ok {
+			if _, ok := f.(func(*RenderCtx, ...interface{}) interface{}); !ok {
+				return newReflectFunc("", f).call(ctx, args)
+			}
+		}
+	}
+
+	fun, err := interfaceToFunc(f)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("func panic: %v", e)
+		}
+	}()
+
+	return fun(ctx, args...), nil
+}
+
+// 查找go值上允许调用的导出方法, 不存在或不允许时返回无效的reflect.Value
+// 对于非指针的值, 也会查找指针接收者的方法(在副本上调用)
+func lookupMethod(v interface{}, name string, allow func(t reflect.Type, name string) bool) reflect.Value {
+	switch v.(type) {
+	case nil, map[string]interface{}, []interface{}, skipMarshalMap, attrsMap, string:
+		return reflect.Value{}
+	}
+
+	rv := reflect.ValueOf(v)
+	m := rv.MethodByName(name)
+	if !m.IsValid() && rv.Kind() != reflect.Ptr && rv.Kind() != reflect.Interface {
+		p := reflect.New(rv.Type())
+		p.Elem().Set(rv)
+		m = p.MethodByName(name)
+	}
+	if m.IsValid() && !allow(rv.Type(), name) {
+		return reflect.Value{}
+	}
+	return m
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// 通过反射调用go方法, 参数会被转换为方法声明的类型, 支持可变参数.
+// prefix是不需要转换的前置参数(如*RenderCtx), args会被转换为之后的参数.
+// 返回第一个返回值, 如果最后一个返回值是error并且不为nil, 则返回这个错误.
+func callReflect(fn reflect.Value, prefix []reflect.Value, args []interface{}) (r interface{}, err error) {
+	ft := fn.Type()
+	in, err := convertArgs(ft, len(prefix), args)
+	if err != nil {
+		return nil, err
+	}
+	copy(in, prefix)
+
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("func panic: %v", e)
+		}
+	}()
+
+	var out []reflect.Value
+	if ft.IsVariadic() {
+		out = fn.CallSlice(in)
+	} else {
+		out = fn.Call(in)
+	}
+
+	if len(out) != 0 && ft.Out(len(out)-1) == errorType {
+		if e := out[len(out)-1]; !e.IsNil() {
+			return nil, e.Interface().(error)
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out[0].Interface(), nil
+}
+
+// 将参数转换为方法声明的类型, 可变参数会被转换为slice(需要使用CallSlice调用)
+// 返回值中前skip个参数为空, 需要调用者填充
+func convertArgs(ft reflect.Type, skip int, args []interface{}) ([]reflect.Value, error) {
+	numIn := ft.NumIn()
+	fixed := numIn
+	if ft.IsVariadic() {
+		fixed--
+		if len(args) < fixed-skip {
+			return nil, fmt.Errorf("want at least %d arguments, got %d", fixed-skip, len(args))
+		}
+	} else if len(args) != numIn-skip {
+		return nil, fmt.Errorf("want %d arguments, got %d", numIn-skip, len(args))
+	}
+
+	in := make([]reflect.Value, numIn)
+	for i := skip; i < fixed; i++ {
+		v, err := util.ConvertTo(args[i-skip], ft.In(i))
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i-skip, err)
+		}
+		in[i] = v
+	}
+
+	if ft.IsVariadic() {
+		st := ft.In(fixed)
+		n := len(args) - (fixed - skip)
+		rest := reflect.MakeSlice(st, n, n)
+		for i := 0; i < n; i++ {
+			arg := fixed - skip + i
+			v, err := util.ConvertTo(args[arg], st.Elem())
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %w", arg, err)
+			}
+			rest.Index(i).Set(v)
+		}
+		in[fixed] = rest
+	}
+	return in, nil
+}
+
+var renderCtxType = reflect.TypeOf((*RenderCtx)(nil))
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// 通过Vpl.Func注册的任意go方法
+type reflectFunc struct {
+	name string
+	fn   reflect.Value
+	// 第一个参数的类型: *RenderCtx或者context.Context, 为nil表示没有
+	ctxType reflect.Type
+}
+
+func newReflectFunc(name string, fn interface{}) *reflectFunc {
+	v := reflect.ValueOf(fn)
+	rf := &reflectFunc{name: name, fn: v}
+	t := v.Type()
+	if t.NumIn() != 0 && !(t.IsVariadic() && t.NumIn() == 1) {
+		switch t.In(0) {
+		case renderCtxType, contextType:
+			rf.ctxType = t.In(0)
+		}
+	}
+	return rf
+}
+
+func (f *reflectFunc) call(ctx *RenderCtx, args []interface{}) (interface{}, error) {
+	var prefix []reflect.Value
+	switch f.ctxType {
+	case renderCtxType:
+		prefix = []reflect.Value{reflect.ValueOf(ctx)}
+	case contextType:
+		c := ctx.Ctx
+		if c == nil {
+			c = context.Background()
+		}
+		prefix = []reflect.Value{reflect.ValueOf(&c).Elem()}
+	}
+
+	r, err := callReflect(f.fn, prefix, args)
+	if err != nil {
+		if f.name == "" {
+			return nil, fmt.Errorf("call func: %w", err)
+		}
+		return nil, fmt.Errorf("call func %s: %w", f.name, err)
+	}
+	return r, nil
+}
+
 type Function func(ctx *RenderCtx, args ...interface{}) interface{}
 
 func emptyFunc(ctx *RenderCtx, args ...interface{}) interface{} {
@@ -425,6 +687,14 @@ func ShouldLookInterface(data interface{}, keys ...string) (desc interface{}, ro
 		rootExist = true
 		desc, _, exist = ShouldLookInterface(c, keys[1:]...)
 		return
+	case attrsMap:
+		c, ok := data[currKey]
+		if !ok {
+			return
+		}
+		rootExist = true
+		desc, _, exist = ShouldLookInterface(c, keys[1:]...)
+		return
 
 	case []interface{}:
 		// 数组
@@ -451,6 +721,15 @@ func ShouldLookInterface(data interface{}, keys ...string) (desc interface{}, ro
 			return len(data), true, true
 		default:
 		}
+	default:
+		// go中的struct/map/slice等类型
+		c, ok := util.LookupReflect(data, currKey)
+		if !ok {
+			return
+		}
+		rootExist = true
+		desc, _, exist = ShouldLookInterface(c, keys[1:]...)
+		return
 	}
 
 	return
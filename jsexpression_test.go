@@ -39,6 +39,10 @@ func TestRunJs(t *testing.T) {
 		{Code: "2 >= 1", Value: true},
 		{Code: "1 < 2", Value: true},
 		{Code: "1 <= 2", Value: true},
+		{Code: "a == 1", Value: true},
+		{Code: "a != 1.5", Value: true},
+		{Code: "info == info", Value: true},
+		{Code: "info == {}", Value: false},
 
 		{Code: "info.sex", Value: 26},
 		{Code: "info.sex+1", Value: 27},
@@ -53,6 +57,15 @@ func TestRunJs(t *testing.T) {
 
 		// call function
 		{Code: "concat(1,2)", Value: "12"},
+
+		// logical operators return the operand
+		{Code: "a && 'yes'", Value: "yes"},
+		{Code: "0 && 'yes'", Value: 0},
+		{Code: "'' || 'default'", Value: "default"},
+		{Code: "a || 'default'", Value: 1},
+		{Code: "undefinedFunc && undefinedFunc()", Value: nil},
+		{Code: "a ? 'yes' : 'no'", Value: "yes"},
+		{Code: "!a ? 'yes' : 'no'", Value: "no"},
 	}
 
 	scope := NewScope(nil)
@@ -97,6 +110,52 @@ func TestRunJs(t *testing.T) {
 
 }
 
+// 逻辑运算与三元运算需要短路, 不执行的分支中的方法不能被调用
+func TestShortCircuit(t *testing.T) {
+	cases := []struct {
+		Code  string
+		Value interface{}
+		Calls int
+	}{
+		{Code: "ok && count('a')", Value: "a", Calls: 1},
+		{Code: "notOk && count('a')", Value: false, Calls: 0},
+		{Code: "ok || count('a')", Value: true, Calls: 0},
+		{Code: "notOk || count('a')", Value: "a", Calls: 1},
+		{Code: "ok ? count('a') : count('b')", Value: "a", Calls: 1},
+		{Code: "notOk ? count('a') : count('b')", Value: "b", Calls: 1},
+		{Code: "notOk ? count('a') : notOk ? count('b') : count('c')", Value: "c", Calls: 1},
+	}
+
+	for _, c := range cases {
+		calls := 0
+		scope := NewScope(nil)
+		scope.Value = map[string]interface{}{
+			"ok":    true,
+			"notOk": false,
+			"count": Function(func(ctx *RenderCtx, args ...interface{}) interface{} {
+				calls++
+				return args[0]
+			}),
+		}
+
+		node, err := compileJS(c.Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := runJsExpression(node, &RenderCtx{Scope: scope})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v != c.Value {
+			t.Fatalf("code %s, want:%+v, get:%+v", c.Code, c.Value, v)
+		}
+		if calls != c.Calls {
+			t.Fatalf("code %s, want %d calls, get:%d", c.Code, c.Calls, calls)
+		}
+	}
+}
+
 func TestInterfaceToBool(t *testing.T) {
 	var a int64 = 0
 	if false != interfaceToBool(a) {
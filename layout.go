@@ -0,0 +1,181 @@
+package vpl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zbysir/vpl/internal/parser"
+)
+
+// 布局继承, 类似jinja的extends/block:
+//
+//	<!-- base -->
+//	<html>
+//	<head><title><block name="title">Site</block></title></head>
+//	<body><block name="content"></block></body>
+//	</html>
+//
+//	<!-- page -->
+//	<extends layout="base">
+//	  <block name="title">Page - <super></super></block>
+//	  <block name="content">...</block>
+//	</extends>
+//
+// <extends>会被编译为对布局组件的调用, 其中的每个<block>会被编译为一个具名slot: <base><template #title><block name="title">...</block></template></base>.
+// 由于覆盖的内容本身也是一个<block>, 所以多层继承时最后一层的覆盖生效, 并且<super>可以逐层访问上一层的内容.
+// 中间的布局没有覆盖的block会被直接传递给上一层布局.
+
+// 将根节点中的<extends layout="base">转为对布局组件的调用
+func (c *compiler) compileExtends(nt *parser.Node) error {
+	var ext *parser.Node
+	for _, n := range nt.Child {
+		if n.NodeType != parser.ElementNode {
+			continue
+		}
+		if n.Tag == "extends" {
+			ext = n
+			break
+		}
+	}
+	if ext == nil {
+		return nil
+	}
+
+	child := nt.Child[:0:0]
+	for _, n := range nt.Child {
+		switch {
+		case n == ext, n.NodeType == parser.CommentNode:
+			child = append(child, n)
+		case n.NodeType == parser.ElementNode:
+			return parser.NewError(n.Pos, fmt.Errorf("unexpected <%s>, a component that extends a layout can only contain <extends>", n.Tag))
+		}
+	}
+	nt.Child = child
+
+	layout := ""
+	attrs := ext.Attrs[:0:0]
+	for _, a := range ext.Attrs {
+		if a.Key == "layout" {
+			layout = a.Value
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	if layout == "" {
+		return parser.NewError(ext.Pos, errors.New("extends: missing 'layout' attribute"))
+	}
+
+	blocks := ext.Child[:0:0]
+	names := map[string]bool{}
+	for _, n := range ext.Child {
+		switch {
+		case n.NodeType == parser.ElementNode && n.Tag == "block":
+			name := ""
+			for _, a := range n.Attrs {
+				if a.Key == "name" {
+					name = a.Value
+				}
+			}
+			if name == "" {
+				return parser.NewError(n.Pos, errors.New("block: missing 'name' attribute"))
+			}
+			if names[name] {
+				return parser.NewError(n.Pos, fmt.Errorf("block %q is already defined", name))
+			}
+			names[name] = true
+
+			t := &parser.Node{
+				NodeType: parser.ElementNode,
+				Tag:      "template",
+				Attrs:    []parser.Attr{{Key: "#" + name, ValPos: n.Pos}},
+				Parent:   ext,
+				Pos:      n.Pos,
+			}
+			t.AddChild(n)
+			blocks = append(blocks, t)
+		case n.NodeType == parser.ElementNode:
+			return parser.NewError(n.Pos, fmt.Errorf("unexpected <%s> in extends, want <block>", n.Tag))
+		case n.NodeType == parser.TextNode:
+			return parser.NewError(n.Pos, errors.New("unexpected text in extends, want <block>"))
+		}
+	}
+
+	ext.Tag = layout
+	ext.Attrs = attrs
+	ext.Child = blocks
+	c.extends, c.extendsPos = true, ext.Pos
+	return nil
+}
+
+// 多层继承时, 中间的布局需要将下一层中自己没有覆盖的block传递给上一层布局,
+// 如page覆盖了base中的head, 而page继承的docs没有覆盖head.
+func forwardBlocks(slots *Slots, received *Slots) *Slots {
+	if received == nil || len(received.NamedSlot) == 0 {
+		return slots
+	}
+	r := &Slots{NamedSlot: make(map[string]*Slot, len(received.NamedSlot))}
+	for k, s := range received.NamedSlot {
+		r.NamedSlot[k] = s
+	}
+	if slots != nil {
+		r.Default = slots.Default
+		for k, s := range slots.NamedSlot {
+			r.NamedSlot[k] = s
+		}
+	}
+	return r
+}
+
+// <block>中<super>需要渲染的内容
+type blockSuper struct {
+	// 上一层的<block>的内容
+	content *Slot
+	// 渲染上一层的内容时的blockSuper
+	parent *blockSuper
+}
+
+// <block name="title">默认内容</block>
+// 如果调用组件时传递了同名的slot(通过<extends>), 则渲染slot, 否则渲染默认内容.
+func execBlock(ctx *StatementCtx, o *StatementOptions) error {
+	name := ""
+	if attr, exist := o.Props.Get("name"); exist {
+		name, _ = attr.(string)
+	}
+	if name == "" {
+		return errors.New("block: missing 'name' prop")
+	}
+
+	var content *Slot
+	if o.Slots != nil {
+		content = o.Slots.Default
+	}
+
+	var override *Slot
+	if o.Parent != nil {
+		override = o.Parent.Slots.Get(name)
+	}
+	if override == nil {
+		if content == nil {
+			return nil
+		}
+		return content.Exec(ctx, nil)
+	}
+
+	c := ctx.Clone()
+	c.blockSuper = &blockSuper{content: content, parent: ctx.blockSuper}
+	return override.Exec(c, nil)
+}
+
+// <super> 渲染上一层<block>的内容, 只能在覆盖block的内容中使用
+func execSuper(ctx *StatementCtx, o *StatementOptions) error {
+	s := ctx.blockSuper
+	if s == nil {
+		return errors.New("super: used outside of an overriding <block>")
+	}
+	if s.content == nil {
+		return nil
+	}
+	c := ctx.Clone()
+	c.blockSuper = s.parent
+	return s.content.Exec(c, nil)
+}
@@ -0,0 +1,210 @@
+package vpl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// NameStrategy 根据文件路径生成组件名.
+// p是相对于LoadFS中root的路径, 使用"/"分隔并且不包含扩展名, 如 "form/text-input"
+type NameStrategy func(p string) string
+
+// NameByBase 使用文件名作为组件名: form/text-input.vue => text-input
+func NameByBase(p string) string {
+	return path.Base(p)
+}
+
+// NameByKebabPath 使用kebab-case的路径作为组件名: form/TextInput.vue => form-text-input
+func NameByKebabPath(p string) string {
+	ss := strings.Split(p, "/")
+	for i, s := range ss {
+		ss[i] = toKebab(s)
+	}
+	return strings.Join(ss, "-")
+}
+
+// NameByNamespace 使用目录作为命名空间: form/text-input.vue => Form.TextInput
+func NameByNamespace(p string) string {
+	ss := strings.Split(p, "/")
+	for i, s := range ss {
+		ss[i] = toPascal(s)
+	}
+	return strings.Join(ss, ".")
+}
+
+// TextInput / text_input => text-input
+func toKebab(s string) string {
+	var b strings.Builder
+	rs := []rune(s)
+	for i, r := range rs {
+		switch {
+		case r == '_' || r == ' ':
+			b.WriteByte('-')
+		case unicode.IsUpper(r):
+			if i > 0 && rs[i-1] != '-' && rs[i-1] != '_' && !unicode.IsUpper(rs[i-1]) {
+				b.WriteByte('-')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// text-input / text_input => TextInput
+func toPascal(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if r == '-' || r == '_' || r == ' ' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// LoadOptions 是LoadFS的选项
+type LoadOptions struct {
+	// 组件的命名方式, 默认为NameByBase
+	Name NameStrategy
+	// 需要加载的文件扩展名, 默认为 .vue 与 .vpl
+	Exts []string
+}
+
+var defaultLoadExts = []string{".vue", ".vpl"}
+
+// LoadFS 加载fsys中root目录下(包括子目录)的所有组件, 可以配合embed.FS将组件打包进程序.
+//
+//	//go:embed components
+//	var components embed.FS
+//
+//	err := v.LoadFS(components, "components", &vpl.LoadOptions{Name: vpl.NameByNamespace})
+//
+// 所有文件都编译成功之后才会注册组件, 否则返回包含所有错误的ErrorList, 其中的编译错误以文件名开头.
+// 以"."开头的文件与目录会被忽略. 加载的目录可以被热更新, 见 Watch.
+func (v *Vpl) LoadFS(fsys fs.FS, root string, opts *LoadOptions) error {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	d := &dirSource{fsys: fsys, root: root, opts: opts}
+	// 在编译之前记录文件状态, 编译之后修改的文件会在下一次Reload时重新加载
+	sign, err := d.signature()
+	if err != nil {
+		return err
+	}
+	cps, err := v.compileFS(fsys, root, opts)
+	if err != nil {
+		return err
+	}
+	d.sign = sign
+	d.names = componentNames(cps)
+
+	v.update(cps, nil)
+	v.mu.Lock()
+	v.dirs = append(v.dirs, d)
+	v.mu.Unlock()
+	return nil
+}
+
+func (o *LoadOptions) name() NameStrategy {
+	if o.Name == nil {
+		return NameByBase
+	}
+	return o.Name
+}
+
+func (o *LoadOptions) exts() []string {
+	if len(o.Exts) == 0 {
+		return defaultLoadExts
+	}
+	return o.Exts
+}
+
+// 遍历fsys中root目录下的所有组件文件, 以"."开头的文件与目录会被忽略
+func walkComponents(fsys fs.FS, root string, exts []string, fn func(p string, d fs.DirEntry) error) error {
+	return fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !hasExt(p, exts) {
+			return nil
+		}
+		return fn(p, d)
+	})
+}
+
+// 编译fsys中的所有组件, 出错时也会返回编译成功的组件
+func (v *Vpl) compileFS(fsys fs.FS, root string, opts *LoadOptions) ([]*compiledComponent, error) {
+	name := opts.name()
+
+	var errs ErrorList
+	var cps []*compiledComponent
+	// 组件名 => 文件名, 用于检查重名
+	files := map[string]string{}
+
+	err := walkComponents(fsys, root, opts.exts(), func(p string, d fs.DirEntry) error {
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+		if root == "." {
+			rel = p
+		}
+		n := name(strings.TrimSuffix(rel, path.Ext(rel)))
+		if prev, exist := files[n]; exist {
+			errs = append(errs, fmt.Errorf("%s: component %q is already defined in %s", p, n, prev))
+			return nil
+		}
+		files[n] = p
+
+		bs, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		cp, err := v.compileSource(n, p, string(bs), nil)
+		if err != nil {
+			// 包含位置的错误已经以文件名开头
+			var ce *CompileError
+			if !errors.As(err, &ce) {
+				err = fmt.Errorf("%s: %w", p, err)
+			}
+			errs = append(errs, err)
+			return nil
+		}
+		cps = append(cps, cp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) != 0 {
+		return cps, errs
+	}
+
+	return cps, nil
+}
+
+func hasExt(p string, exts []string) bool {
+	ext := path.Ext(p)
+	for _, e := range exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
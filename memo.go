@@ -0,0 +1,271 @@
+package vpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zbysir/vpl/internal/parser"
+)
+
+// v-memo / v-once, 缓存子树渲染得到的字符串:
+//
+//	<nav v-memo="[locale, user.role]">...</nav>
+//	<footer v-once>...</footer>
+//
+// v-memo的结果保存在Vpl的LRU缓存中(见WithMemoSize), key为 组件名 + 语句编号 + 依赖的值(json);
+// v-once的结果保存在语句上, 在组件被重新编译(如热更新)之前一直有效. 在v-for中时每一次循环(按下标)分别缓存,
+// 在组件中时组件的所有调用共用一个结果.
+//
+// 子树中使用的组件样式和推送到输出口的内容(<teleport>)会和结果一起缓存, 命中缓存时重新提交到本次渲染中.
+// 没有命中缓存时子树和其他语句一样渲染(不会等待其中的parallel), 在计算结果时才写入缓存.
+// 其中的parallel出错或超时而渲染了备选内容(#error)时不会写入缓存.
+
+// 每个v-memo语句的编号, 用于区分同一个组件中的多个v-memo
+var memoSeq int64
+
+type memoStatement struct {
+	component string
+	id        int64
+	// v-memo的依赖, v-once时为nil
+	deps     *jsExpression
+	depsCode string
+	child    Statement
+
+	// v-once的结果(*memoResult), key为v-for中各层循环的下标, 见loopKey
+	once sync.Map
+}
+
+// 缓存的渲染结果, 创建之后不会被修改. 组件缓存时会被序列化为json保存在CacheStore中
+type memoResult struct {
+	HTML      string         `json:"html"`
+	Styles    []memoStyle    `json:"styles,omitempty"`
+	Teleports []memoTeleport `json:"teleports,omitempty"`
+}
+
+type memoStyle struct {
+	Component string `json:"component"`
+	CSS       string `json:"css"`
+	// 是否直接输出在了结果中, 见StatementCtx.useStyle
+	Inline bool `json:"inline,omitempty"`
+}
+
+type memoTeleport struct {
+	To   string `json:"to"`
+	Key  string `json:"key,omitempty"`
+	HTML string `json:"html"`
+}
+
+// 记录子树中的副作用, 子树本身仍然正常提交这些副作用
+type memoRecorder struct {
+	// 嵌套的v-memo/组件缓存中, 外层的结果也需要包含内层的副作用
+	parent *memoRecorder
+
+	mu        sync.Mutex
+	styles    []memoStyle
+	teleports []recordedTeleport
+	// 子树中渲染了<parallel>出错或超时时的备选内容, 结果不会被缓存
+	fallback bool
+}
+
+type recordedTeleport struct {
+	to   string
+	key  string
+	span Span
+}
+
+func (r *memoRecorder) addStyle(component string, css string, inline bool) {
+	r.mu.Lock()
+	r.styles = append(r.styles, memoStyle{Component: component, CSS: css, Inline: inline})
+	r.mu.Unlock()
+	if r.parent != nil {
+		r.parent.addStyle(component, css, inline)
+	}
+}
+
+// 标记子树中渲染了备选内容
+func (r *memoRecorder) addFallback() {
+	r.mu.Lock()
+	r.fallback = true
+	r.mu.Unlock()
+	if r.parent != nil {
+		r.parent.addFallback()
+	}
+}
+
+// 返回的span需要代替原来的span推送到输出口中
+func (r *memoRecorder) addTeleport(to string, key string, span Span) Span {
+	s := &sharedSpan{span: span}
+	r.mu.Lock()
+	r.teleports = append(r.teleports, recordedTeleport{to: to, key: key, span: s})
+	r.mu.Unlock()
+	if r.parent != nil {
+		r.parent.addTeleport(to, key, s)
+	}
+	return s
+}
+
+// 可以被多次计算结果的span, 输出口与v-memo都需要读取推送的内容
+type sharedSpan struct {
+	span Span
+	once sync.Once
+	s    string
+	err  error
+}
+
+func (s *sharedSpan) Result() (string, error) {
+	s.once.Do(func() {
+		s.s, s.err = s.span.Result()
+	})
+	return s.s, s.err
+}
+
+func (c *compiler) compileMemo(v *parser.VueElement, child Statement) (Statement, error) {
+	m := &memoStatement{
+		component: c.component,
+		id:        atomic.AddInt64(&memoSeq, 1),
+		child:     child,
+	}
+	if v.VMemo.Once {
+		// 需要外层的v-for提供$loop, 用于区分每一次循环
+		c.loopRefs++
+	} else {
+		deps, err := c.compileExpression(v.VMemo.Deps, "v-memo", v.VMemo.Pos)
+		if err != nil {
+			return nil, err
+		}
+		m.deps = deps
+		m.depsCode = v.VMemo.Deps
+	}
+	return m, nil
+}
+
+func (m *memoStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
+	if m.deps == nil {
+		key := loopKey(o.Scope)
+		if r, ok := m.once.Load(key); ok {
+			r.(*memoResult).writeTo(ctx)
+			return nil
+		}
+		return renderCached(ctx, m.exec(o), func(r *memoResult) {
+			m.once.Store(key, r)
+		})
+	}
+
+	rCtx := ctx.getRenderCtx(o.Scope)
+	deps, err := m.deps.Exec(rCtx)
+	ctxPool.Put(rCtx)
+	if err != nil {
+		return err
+	}
+	if ctx.memoCache == nil {
+		return m.child.Exec(ctx, o)
+	}
+	bs, err := json.Marshal(deps)
+	if err != nil {
+		return fmt.Errorf("v-memo %q: %w", m.depsCode, err)
+	}
+	key := fmt.Sprintf("%s\x00%d\x00%s", m.component, m.id, bs)
+
+	if r, ok := ctx.memoCache.Get(key); ok {
+		r.(*memoResult).writeTo(ctx)
+		return nil
+	}
+	return renderCached(ctx, m.exec(o), func(r *memoResult) {
+		ctx.memoCache.Set(key, r, 0)
+	})
+}
+
+// v-for中每一次循环的key, 由内到外各层循环的下标组成, 不在v-for中时为空字符串
+func loopKey(scope *Scope) string {
+	l, _ := scope.Lookup("$loop")
+	var b strings.Builder
+	for {
+		m, ok := l.(map[string]interface{})
+		if !ok {
+			break
+		}
+		fmt.Fprintf(&b, "%v,", m["index"])
+		l = m["parent"]
+	}
+	return b.String()
+}
+
+func (m *memoStatement) exec(o *StatementOptions) func(ctx *StatementCtx) error {
+	return func(ctx *StatementCtx) error {
+		return m.child.Exec(ctx, o)
+	}
+}
+
+// 使用exec渲染, 在结果计算完成(其中的parallel都已经执行完成)之后调用store缓存结果.
+// 用于v-memo/v-once与组件缓存
+func renderCached(ctx *StatementCtx, exec func(ctx *StatementCtx) error, store func(r *memoResult)) error {
+	w := NewListWriter()
+	rec := &memoRecorder{parent: ctx.memo}
+	c := ctx.Clone()
+	c.W = w
+	c.memo = rec
+	err := exec(c)
+	if err != nil {
+		return err
+	}
+	ctx.W.WriteSpan(&memoSpan{w: w, rec: rec, store: store})
+	return nil
+}
+
+type memoSpan struct {
+	w     *ListWriter
+	rec   *memoRecorder
+	store func(r *memoResult)
+}
+
+func (s *memoSpan) Result() (string, error) {
+	html, err := s.w.Result()
+	if err != nil {
+		return "", err
+	}
+
+	s.rec.mu.Lock()
+	r := &memoResult{HTML: html, Styles: s.rec.styles}
+	teleports := s.rec.teleports
+	fallback := s.rec.fallback
+	s.rec.mu.Unlock()
+	// 备选内容只是这一次渲染的结果, 缓存它会让之后的渲染一直使用备选内容
+	if fallback {
+		return html, nil
+	}
+	for _, t := range teleports {
+		c, err := t.span.Result()
+		if err != nil {
+			return "", err
+		}
+		r.Teleports = append(r.Teleports, memoTeleport{To: t.to, Key: t.key, HTML: c})
+	}
+	s.store(r)
+	return html, nil
+}
+
+// 将缓存的结果写入本次渲染
+func (r *memoResult) writeTo(ctx *StatementCtx) {
+	for _, s := range r.Styles {
+		if s.Inline {
+			ctx.styleWritten(s.Component, s.CSS)
+		} else {
+			ctx.useStyle(s.Component, s.CSS)
+		}
+	}
+	for _, t := range r.Teleports {
+		ctx.PushOutlet(t.To, t.Key, &StringSpan{s: t.HTML})
+	}
+	ctx.W.WriteString(r.HTML)
+}
+
+// 输出口需要等待整个页面渲染完成, 不能被缓存
+func checkMemo(ctx *StatementCtx, tag string) error {
+	if ctx.memo != nil {
+		return fmt.Errorf("<%s> can not be used in v-memo, v-once or a cached component", tag)
+	}
+	return nil
+}
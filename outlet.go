@@ -0,0 +1,302 @@
+package vpl
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 输出口: 页面中任意位置的组件都可以向输出口推送内容(如<head>中的样式/脚本), 即使输出口在文档中出现得更早.
+// 输出口写入的是deferredSpan, 在整个渲染(包括所有parallel块)执行完成之后才计算结果.
+//
+//	<!-- layout -->
+//	<html><head><vpl-outlet name="head"></vpl-outlet></head><body><slot></slot></body></html>
+//
+//	<!-- 任意组件 -->
+//	<vpl-head key="chart-js"><script src="/chart.js"></script></vpl-head>
+//	<teleport to="head" key="chart-css"><link rel="stylesheet" href="/chart.css"></teleport>
+
+// 一次渲染中共享的状态, 在StatementCtx.Clone时共享同一个.
+// 每次渲染都会创建, 所以其中的字段都在第一次使用时才创建, 没有使用输出口/样式/parallel的模板只需要分配这个结构体
+type renderState struct {
+	mu sync.Mutex
+	// 有输出口等待时才创建
+	cond *sync.Cond
+	// 正在执行的语句数量(包括整个渲染与每个parallel),
+	// 输出口需要等待它们都执行完成之后才能得到完整的内容
+	running int
+
+	// 是否已经写出了<vpl-styles>
+	styleOutlet bool
+	// 已经使用过的组件样式
+	styleUsed map[string]bool
+	// 需要输出到<vpl-styles>中的样式
+	styles []string
+
+	// 命名的输出口
+	outlets map[string]*outlet
+}
+
+type outlet struct {
+	// 是否已经写出了输出口
+	rendered bool
+	// 已经推送过的key
+	keys  map[string]bool
+	spans []Span
+}
+
+// 创建渲染状态, 整个渲染算作一个正在执行的语句, 渲染执行完成时需要调用end
+func newRenderState() *renderState {
+	return &renderState{running: 1}
+}
+
+// 开始执行一个语句, 返回的方法在执行完成时调用, 可以调用多次
+func (s *renderState) start() func() {
+	s.mu.Lock()
+	s.running++
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(s.end)
+	}
+}
+
+// 一个语句执行完成
+func (s *renderState) end() {
+	s.mu.Lock()
+	s.running--
+	if s.running == 0 && s.cond != nil {
+		s.cond.Broadcast()
+	}
+	s.mu.Unlock()
+}
+
+// 等待所有语句执行完成
+func (s *renderState) wait() {
+	s.mu.Lock()
+	for s.running != 0 {
+		if s.cond == nil {
+			s.cond = sync.NewCond(&s.mu)
+		}
+		s.cond.Wait()
+	}
+	s.mu.Unlock()
+}
+
+// 需要持有锁
+func (s *renderState) outlet(name string) *outlet {
+	o, ok := s.outlets[name]
+	if !ok {
+		if s.outlets == nil {
+			s.outlets = map[string]*outlet{}
+		}
+		o = &outlet{keys: map[string]bool{}}
+		s.outlets[name] = o
+	}
+	return o
+}
+
+// 标记组件的样式已经使用过, 需要持有锁
+func (s *renderState) useStyle(component string) {
+	if s.styleUsed == nil {
+		s.styleUsed = map[string]bool{}
+	}
+	s.styleUsed[component] = true
+}
+
+// 占用key, key已经被使用过时返回false, 空的key不去重
+func (s *renderState) claim(name string, key string) bool {
+	if key == "" {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.outlet(name)
+	if o.keys[key] {
+		return false
+	}
+	o.keys[key] = true
+	return true
+}
+
+func (s *renderState) push(name string, span Span) {
+	s.mu.Lock()
+	o := s.outlet(name)
+	o.spans = append(o.spans, span)
+	s.mu.Unlock()
+}
+
+// 在所有语句执行完成后才计算结果的span, 用于实现输出口
+type deferredSpan struct {
+	state  *renderState
+	result func() (string, error)
+}
+
+func (d *deferredSpan) Result() (string, error) {
+	d.state.wait()
+	return d.result()
+}
+
+// PushOutlet 向名为name的输出口推送内容, 内容会在<vpl-outlet name="...">处输出.
+// 同一个输出口中相同的key只会推送一次, 返回false表示key已经被推送过; key为空时不去重.
+// 用于在go中实现的组件(FuncStatement)向<head>等位置添加内容.
+func (c *StatementCtx) PushOutlet(name string, key string, span Span) bool {
+	if c.state == nil {
+		return false
+	}
+	if c.memo != nil {
+		span = c.memo.addTeleport(name, key, span)
+	}
+	if !c.state.claim(name, key) {
+		return false
+	}
+	c.state.push(name, span)
+	return true
+}
+
+// <teleport to="head" key="...">与<vpl-head key="...">, 将子节点渲染到输出口中.
+// 没有被渲染的输出口中的内容会被丢弃.
+func execTeleport(ctx *StatementCtx, o *StatementOptions, to string) error {
+	if o.Slots == nil || o.Slots.Default == nil {
+		return nil
+	}
+	key := ""
+	if k, exist := o.Props.Get("key"); exist && k != nil {
+		key = fmt.Sprint(k)
+	}
+	// 没有渲染状态(如自行构造的StatementCtx)时直接在原地渲染
+	if ctx.state == nil {
+		return o.Slots.Default.Exec(ctx, nil)
+	}
+	claimed := ctx.state.claim(to, key)
+	// 在v-memo中即使key已经被使用过也需要渲染, 之后命中缓存时才能推送
+	if !claimed && ctx.memo == nil {
+		return nil
+	}
+
+	w := NewListWriter()
+	c := ctx.Clone()
+	c.W = w
+	err := o.Slots.Default.Exec(c, nil)
+	if err != nil {
+		return err
+	}
+	var span Span = w
+	if ctx.memo != nil {
+		span = ctx.memo.addTeleport(to, key, w)
+	}
+	if claimed {
+		ctx.state.push(to, span)
+	}
+	return nil
+}
+
+// <vpl-outlet name="head"> 输出推送到输出口中的内容, name默认为head. 同名的输出口只有第一个生效.
+// 由于需要等待整个页面渲染完成, 在流式渲染时它之后的内容会在渲染完成之后才被写出.
+func execOutlet(ctx *StatementCtx, o *StatementOptions) error {
+	name := "head"
+	if n, exist := o.Props.Get("name"); exist {
+		if s, ok := n.(string); ok && s != "" {
+			name = s
+		}
+	}
+	if err := checkMemo(ctx, "vpl-outlet"); err != nil {
+		return err
+	}
+	s := ctx.state
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	ol := s.outlet(name)
+	if ol.rendered {
+		s.mu.Unlock()
+		return nil
+	}
+	ol.rendered = true
+	s.mu.Unlock()
+
+	ctx.W.WriteSpan(&deferredSpan{state: s, result: func() (string, error) {
+		s.mu.Lock()
+		spans := ol.spans
+		s.mu.Unlock()
+
+		var b strings.Builder
+		for _, span := range spans {
+			r, err := span.Result()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(r)
+		}
+		return b.String(), nil
+	}})
+	return nil
+}
+
+// 记录组件使用的样式, 如果还没有写出<vpl-styles>则直接在组件之前输出<style>
+func (c *StatementCtx) useStyle(component string, css string) {
+	inline := true
+	if s := c.state; s != nil {
+		s.mu.Lock()
+		switch {
+		case s.styleUsed[component]:
+			inline = false
+		case s.styleOutlet:
+			s.styles = append(s.styles, css)
+			inline = false
+		}
+		s.useStyle(component)
+		s.mu.Unlock()
+	}
+
+	if inline {
+		c.W.WriteString("<style>" + css + "</style>")
+	}
+	if c.memo != nil {
+		c.memo.addStyle(component, css, inline)
+	}
+}
+
+// 样式已经包含在了缓存的v-memo结果中, 只需要标记为已使用
+func (c *StatementCtx) styleWritten(component string, css string) {
+	if s := c.state; s != nil {
+		s.mu.Lock()
+		s.useStyle(component)
+		s.mu.Unlock()
+	}
+	if c.memo != nil {
+		c.memo.addStyle(component, css, true)
+	}
+}
+
+// <vpl-styles> 输出本次渲染中使用到的所有组件样式, 通常放在<head>中.
+// 由于需要等待整个页面渲染完成, 在流式渲染时它之后的内容会在渲染完成之后才被写出.
+func execStyleOutlet(ctx *StatementCtx, o *StatementOptions) error {
+	if err := checkMemo(ctx, "vpl-styles"); err != nil {
+		return err
+	}
+	s := ctx.state
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	if s.styleOutlet {
+		// 只有第一个<vpl-styles>生效
+		s.mu.Unlock()
+		return nil
+	}
+	s.styleOutlet = true
+	s.mu.Unlock()
+
+	ctx.W.WriteSpan(&deferredSpan{state: s, result: func() (string, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(s.styles) == 0 {
+			return "", nil
+		}
+		return "<style>" + strings.Join(s.styles, "\n") + "</style>", nil
+	}})
+	return nil
+}
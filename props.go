@@ -0,0 +1,417 @@
+package vpl
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/robertkrimen/otto/ast"
+	"github.com/zbysir/vpl/internal/parser"
+)
+
+// PropType 是prop的类型, 为空时不检查类型
+type PropType string
+
+const (
+	PropAny    PropType = ""
+	PropString PropType = "string"
+	PropNumber PropType = "number"
+	PropBool   PropType = "bool"
+	PropArray  PropType = "array"
+	PropObject PropType = "object"
+)
+
+// PropDef 声明组件的一个prop
+type PropDef struct {
+	Name     string
+	Type     PropType
+	Required bool
+	// 没有传递prop时使用的值
+	Default interface{}
+}
+
+// ErrPropRequired 在没有传递必须的prop时返回
+var ErrPropRequired = errors.New("missing required prop")
+
+// PropError 是prop校验失败的错误
+type PropError struct {
+	Prop string
+	Err  error
+}
+
+func (e *PropError) Error() string {
+	return fmt.Sprintf("prop %q: %v", e.Prop, e.Err)
+}
+
+func (e *PropError) Unwrap() error {
+	return e.Err
+}
+
+// 包含声明(props/style)的组件
+type declComponent struct {
+	Statement
+	name string
+	// 声明的props, 没有声明时为nil
+	props []PropDef
+	// 组件的样式, 在渲染时收集, 见 renderState
+	style string
+}
+
+// 校验props, 并填充默认值与转换类型, 返回新的Props.
+func (p *declComponent) applyProps(props *Props) (*Props, error) {
+	if p.props == nil {
+		return props, nil
+	}
+	r := NewProps()
+	r.appendProps(props)
+	for _, def := range p.props {
+		v, exist := r.Get(def.Name)
+		if !exist || v == nil {
+			if def.Required {
+				return nil, &PropError{Prop: def.Name, Err: ErrPropRequired}
+			}
+			if def.Default != nil {
+				// 默认值在每次渲染中共享, 需要复制一份, 避免在渲染中被修改
+				r.set(def.Name, copyDefault(def.Default))
+			}
+			continue
+		}
+
+		c, err := coerceProp(def.Name, v, def.Type)
+		if err != nil {
+			return nil, &PropError{Prop: def.Name, Err: err}
+		}
+		r.set(def.Name, c)
+	}
+
+	return r, nil
+}
+
+// 深复制prop的默认值, 默认值只会是字面量, 所以只需要处理数组与对象
+func copyDefault(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = copyDefault(item)
+		}
+		return c
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			c[k] = copyDefault(item)
+		}
+		return c
+	}
+	return v
+}
+
+// 返回声明的props的值, 没有传递的prop为nil, 这样在严格模式下也可以使用可选的prop
+func (p *declComponent) declared(props *Props) map[string]interface{} {
+	m := make(map[string]interface{}, len(p.props))
+	for _, def := range p.props {
+		v, _ := props.Get(def.Name)
+		m[def.Name] = v
+	}
+	return m
+}
+
+// 返回没有被声明为props的属性
+func (p *declComponent) attrs(props *Props) attrsMap {
+	attrs := attrsMap{}
+	props.ForEach(func(index int, k *PropKeys, v interface{}) {
+		for _, def := range p.props {
+			if def.Name == k.Key {
+				return
+			}
+		}
+		attrs[k.Key] = v
+	})
+	return attrs
+}
+
+// 合并props声明, b中的同名prop会覆盖a
+func mergePropDefs(a, b []PropDef) []PropDef {
+	r := make([]PropDef, 0, len(a)+len(b))
+	r = append(r, a...)
+outer:
+	for _, def := range b {
+		for i := range r {
+			if r[i].Name == def.Name {
+				r[i] = def
+				continue outer
+			}
+		}
+		r = append(r, def)
+	}
+	return r
+}
+
+// 将prop转换为声明的类型, 静态的属性(字符串)可以转为number/bool, name为prop的名字
+func coerceProp(name string, v interface{}, t PropType) (interface{}, error) {
+	switch t {
+	case PropAny:
+		return v, nil
+	case PropString:
+		if _, ok := v.(string); ok {
+			return v, nil
+		}
+	case PropNumber:
+		if _, ok := isNumber(v); ok {
+			return v, nil
+		}
+		if s, ok := v.(string); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot convert %q to number", s)
+			}
+			return f, nil
+		}
+	case PropBool:
+		if _, ok := v.(bool); ok {
+			return v, nil
+		}
+		if s, ok := v.(string); ok {
+			// <my-button disabled> 与 <my-button disabled="disabled"> 都表示true
+			switch s {
+			case "", "true":
+				return true, nil
+			case "false":
+				return false, nil
+			}
+			if strings.EqualFold(s, name) {
+				return true, nil
+			}
+			return nil, fmt.Errorf("cannot convert %q to bool", s)
+		}
+	case PropArray:
+		if rv, ok := indirectValue(v); ok && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) {
+			return v, nil
+		}
+	case PropObject:
+		if rv, ok := indirectValue(v); ok && (rv.Kind() == reflect.Map || rv.Kind() == reflect.Struct) {
+			return v, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", t)
+	}
+
+	return nil, fmt.Errorf("want %s, got %T", t, v)
+}
+
+func indirectValue(v interface{}) (reflect.Value, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}, false
+		}
+		rv = rv.Elem()
+	}
+	return rv, rv.IsValid()
+}
+
+// 在声明props时可以使用的类型名, 兼容vue的写法: {title: String}
+var propTypeNames = map[string]PropType{
+	"string":  PropString,
+	"number":  PropNumber,
+	"bool":    PropBool,
+	"boolean": PropBool,
+	"array":   PropArray,
+	"object":  PropObject,
+	"any":     PropAny,
+}
+
+// 执行<script>中的声明, 其中可以使用String/Number等类型名. 兼容SFC中的 export default {...} 写法
+func (c *compiler) evalDeclaration(code string, statement string, pos int) (interface{}, ast.Node, error) {
+	trimmed := strings.TrimSpace(code)
+	if strings.HasPrefix(trimmed, "export default") {
+		pos += strings.Index(code, "export default") + len("export default")
+		code = strings.TrimPrefix(trimmed, "export default")
+	}
+	code = strings.TrimSuffix(strings.TrimRight(code, " \t\r\n"), ";")
+	if strings.TrimSpace(code) == "" {
+		return nil, nil, nil
+	}
+
+	exp, err := c.compileExpression(code, statement, pos)
+	if err != nil {
+		return nil, nil, err
+	}
+	scope := NewScope(nil)
+	for _, name := range []string{"String", "Number", "Boolean", "Array", "Object"} {
+		scope.Set(name, strings.ToLower(name))
+	}
+	v, err := runJsExpression(exp.node, &RenderCtx{Scope: scope})
+	if err != nil {
+		return nil, nil, parser.NewError(pos, err)
+	}
+	return v, exp.node, nil
+}
+
+func (c *compiler) compileOptions(code string, pos int) error {
+	v, _, err := c.evalDeclaration(code, "script options", pos)
+	if err != nil {
+		return err
+	}
+	options, ok := v.(map[string]interface{})
+	if !ok && v != nil {
+		return parser.NewError(pos, fmt.Errorf("options must be an object, got %T", v))
+	}
+	for k, v := range options {
+		err := c.setOption(k, v)
+		if err != nil {
+			return parser.NewError(pos, err)
+		}
+	}
+	return nil
+}
+
+func (c *compiler) setOption(k string, v interface{}) error {
+	switch k {
+	case "inheritAttrs":
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("inheritAttrs must be a bool, got %T", v)
+		}
+		c.noInheritAttrs = !b
+	default:
+		return fmt.Errorf("unknown option %q", k)
+	}
+	return nil
+}
+
+// inheritAttrs: false时, 根节点不再自动继承$attrs
+func clearDistributionAttr(root *parser.VueElement) {
+	for _, c := range root.Children {
+		c.DistributionAttr = false
+		if c.VIf != nil {
+			for _, e := range c.VIf.ElseIf {
+				e.VueElement.DistributionAttr = false
+			}
+		}
+	}
+}
+
+func hasAttr(n *parser.Node, key string) bool {
+	for _, a := range n.Attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiler) compilePropDefs(code string, pos int) ([]PropDef, error) {
+	v, node, err := c.evalDeclaration(code, "script props", pos)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := toPropDefs(v, node)
+	if err != nil {
+		return nil, parser.NewError(pos, err)
+	}
+	return defs, nil
+}
+
+// node是声明props的表达式, 用于获取key的顺序
+func toPropDefs(v interface{}, node ast.Node) ([]PropDef, error) {
+	defs := []PropDef{}
+	switch v := v.(type) {
+	case nil:
+		// {}
+	case []interface{}:
+		for _, name := range v {
+			s, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("prop name must be a string, got %T", name)
+			}
+			defs = append(defs, PropDef{Name: s})
+		}
+	case map[string]interface{}:
+		// 保持声明的顺序, 让校验的错误稳定
+		for _, name := range objectKeys(node) {
+			def, err := toPropDef(name, v[name])
+			if err != nil {
+				return nil, err
+			}
+			defs = append(defs, def)
+		}
+	default:
+		return nil, fmt.Errorf("props must be an object or an array, got %T", v)
+	}
+
+	return defs, nil
+}
+
+func toPropDef(name string, v interface{}) (PropDef, error) {
+	def := PropDef{Name: name}
+	switch v := v.(type) {
+	case nil:
+	case string:
+		t, ok := propTypeNames[v]
+		if !ok {
+			return def, fmt.Errorf("prop %q: unknown type %q", name, v)
+		}
+		def.Type = t
+	case map[string]interface{}:
+		if t, ok := v["type"]; ok {
+			s, _ := t.(string)
+			pt, ok := propTypeNames[s]
+			if !ok {
+				return def, fmt.Errorf("prop %q: unknown type %v", name, t)
+			}
+			def.Type = pt
+		}
+		if r, ok := v["required"].(bool); ok {
+			def.Required = r
+		}
+		if d, ok := v["default"]; ok && d != nil {
+			c, err := coerceProp(name, d, def.Type)
+			if err != nil {
+				return def, fmt.Errorf("prop %q: default: %w", name, err)
+			}
+			def.Default = c
+		}
+	default:
+		return def, fmt.Errorf("prop %q: want a type or an object, got %T", name, v)
+	}
+
+	return def, nil
+}
+
+// 对象字面量中key的顺序
+func objectKeys(node ast.Node) []string {
+	o, ok := objectLiteral(node)
+	if !ok {
+		return nil
+	}
+	keys := make([]string, len(o.Value))
+	for i, v := range o.Value {
+		keys[i] = v.Key
+	}
+	return keys
+}
+
+// 对象字面量中key对应的表达式
+func objectProperty(node ast.Node, key string) ast.Node {
+	o, ok := objectLiteral(node)
+	if !ok {
+		return nil
+	}
+	for _, v := range o.Value {
+		if v.Key == key {
+			return v.Value
+		}
+	}
+	return nil
+}
+
+func objectLiteral(node ast.Node) (*ast.ObjectLiteral, bool) {
+	if s, ok := node.(*ast.ExpressionStatement); ok {
+		node = s.Expression
+	}
+	o, ok := node.(*ast.ObjectLiteral)
+	return o, ok
+}
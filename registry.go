@@ -0,0 +1,104 @@
+package vpl
+
+// 注册的组件/指令/全局变量.
+// registry在创建之后不会再被修改, 每次注册都会生成新的registry并原子地替换(copy-on-write).
+// 每次渲染开始时读取一次registry, 所以一次渲染中看到的始终是同一组组件, 并且注册与渲染可以并发进行.
+type registry struct {
+	components map[string]Statement
+	// 每个组件中静态调用的组件, 用于CheckComponents
+	refs map[string][]componentRef
+	// 指令
+	directives map[string]Directive
+	// 类似原型链, 用于注册方法/等全局变量, 这些变量在每一个组件中都可以使用
+	prototype *Scope
+	// 组件缓存的设置, 见CacheComponent
+	caches map[string]*componentCache
+	// 每个组件被注册(编译)的次数
+	versions map[string]int64
+	// 注册或删除任意组件的次数, 组件缓存的key中包含这个版本.
+	// 缓存的组件中可能调用了其他组件, 所以任意组件被重新注册之后都不再使用之前缓存的结果
+	generation int64
+}
+
+// 当前的registry, 返回值不能被修改
+func (v *Vpl) load() *registry {
+	return v.reg.Load().(*registry)
+}
+
+// 修改registry, fn中只能修改r的字段本身(如替换map), 而不能修改其中的map
+func (v *Vpl) modify(fn func(r *registry)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.modifyLocked(fn)
+}
+
+func (v *Vpl) modifyLocked(fn func(r *registry)) {
+	r := *v.load()
+	fn(&r)
+	v.reg.Store(&r)
+}
+
+func newRegistry(components map[string]Statement) *registry {
+	return &registry{
+		components: components,
+		refs:       map[string][]componentRef{},
+		directives: map[string]Directive{},
+		prototype:  NewScope(nil),
+		caches:     map[string]*componentCache{},
+		versions:   map[string]int64{},
+	}
+}
+
+// 注册与删除组件, remove先于set执行
+func (r *registry) setComponents(set []*compiledComponent, remove []string) {
+	components := make(map[string]Statement, len(r.components)+len(set))
+	for k, c := range r.components {
+		components[k] = c
+	}
+	refs := make(map[string][]componentRef, len(r.refs)+len(set))
+	for k, c := range r.refs {
+		refs[k] = c
+	}
+	versions := make(map[string]int64, len(r.versions)+len(set))
+	for k, n := range r.versions {
+		versions[k] = n
+	}
+
+	for _, name := range remove {
+		delete(components, name)
+		delete(refs, name)
+		versions[name]++
+	}
+	for _, cp := range set {
+		components[cp.name] = cp.statement
+		versions[cp.name]++
+		if cp.refs != nil {
+			refs[cp.name] = cp.refs
+		} else {
+			delete(refs, cp.name)
+		}
+	}
+
+	r.components = components
+	r.refs = refs
+	r.versions = versions
+	r.generation++
+}
+
+func (r *registry) setDirective(name string, d Directive) {
+	directives := make(map[string]Directive, len(r.directives)+1)
+	for k, d := range r.directives {
+		directives[k] = d
+	}
+	directives[name] = d
+	r.directives = directives
+}
+
+func (r *registry) setGlobal(name string, val interface{}) {
+	prototype := NewScope(r.prototype.Parent)
+	for k, v := range r.prototype.Value {
+		prototype.Set(k, v)
+	}
+	prototype.Set(name, val)
+	r.prototype = prototype
+}
@@ -0,0 +1,354 @@
+package vpl
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/zbysir/vpl/internal/parser"
+)
+
+// 单文件组件(SFC), 与vue的.vue文件相同:
+//
+//	<template>
+//	  <div class="card"><slot></slot></div>
+//	</template>
+//
+//	<script>
+//	export default {
+//	  props: {title: String},
+//	  inheritAttrs: false,
+//	}
+//	</script>
+//
+//	<style scoped>
+//	.card { padding: 8px }
+//	</style>
+//
+// 当根节点中有一个没有属性的<template>时, 组件会被当做SFC解析, 此时根节点只能是<template>/<script>/<style>.
+// <script>只用于声明props与选项, 不会被执行.
+// 不论是否为SFC, 根节点中的<style>都会被取出, 在渲染时收集到<vpl-styles>中, 同一个组件的样式在一次渲染中只输出一次.
+
+// 从模板中取出<script>与<style>等声明, 它们只能是根节点.
+//
+// <script props>声明组件的props, 如:
+//
+//	<script props>
+//	{
+//	  title: {type: String, required: true},
+//	  count: {type: 'number', default: 1},
+//	  tags: Array,
+//	}
+//	</script>
+//
+// 也支持数组写法: ['title', 'count'], 此时不检查类型.
+//
+// <script options>声明组件的选项, 目前只支持inheritAttrs:
+//
+//	<script options>{inheritAttrs: false}</script>
+//
+// 在SFC中, <script>可以同时声明props与选项: export default {props: [...], inheritAttrs: false}
+func (c *compiler) extractBlocks(nt *parser.Node) error {
+	sfc := isSFC(nt)
+	scoped := false
+	var styles []string
+
+	child := nt.Child[:0:0]
+	for _, n := range nt.Child {
+		if n.NodeType != parser.ElementNode {
+			child = append(child, n)
+			continue
+		}
+
+		code, pos := "", n.Pos
+		if len(n.Child) != 0 {
+			code, pos = n.Child[0].Text, n.Child[0].Pos
+		}
+		switch {
+		case n.Tag == "script" && hasAttr(n, "props"):
+			defs, err := c.compilePropDefs(code, pos)
+			if err != nil {
+				return err
+			}
+			c.props = defs
+		case n.Tag == "script" && hasAttr(n, "options"):
+			err := c.compileOptions(code, pos)
+			if err != nil {
+				return err
+			}
+		case n.Tag == "script" && sfc:
+			err := c.compileScript(code, pos)
+			if err != nil {
+				return err
+			}
+		case n.Tag == "style":
+			for _, a := range n.Attrs {
+				if a.Key == "lang" && a.Value != "css" {
+					return parser.NewError(n.Pos, fmt.Errorf("unsupported style lang %q", a.Value))
+				}
+			}
+			css := strings.TrimSpace(code)
+			if hasAttr(n, "scoped") {
+				scoped = true
+				css = scopeCSS(css, c.scopeAttr())
+			}
+			if css != "" {
+				styles = append(styles, css)
+			}
+		case sfc && n.Tag != "template":
+			return parser.NewError(n.Pos, fmt.Errorf("unexpected <%s> in single-file component, want <template>, <script> or <style>", n.Tag))
+		default:
+			child = append(child, n)
+		}
+	}
+	nt.Child = child
+	c.style = strings.Join(styles, "\n")
+
+	if scoped {
+		addScopeAttr(nt, c.scopeAttr())
+	}
+
+	return nil
+}
+
+// 根节点中有一个没有属性的<template>
+func isSFC(nt *parser.Node) bool {
+	templates := 0
+	for _, n := range nt.Child {
+		if n.NodeType == parser.ElementNode && n.Tag == "template" {
+			if len(n.Attrs) != 0 {
+				return false
+			}
+			templates++
+		}
+	}
+	return templates == 1
+}
+
+// SFC中的<script>, 声明props与选项
+func (c *compiler) compileScript(code string, pos int) error {
+	v, node, err := c.evalDeclaration(code, "script", pos)
+	if err != nil {
+		return err
+	}
+	decl, ok := v.(map[string]interface{})
+	if !ok && v != nil {
+		return parser.NewError(pos, fmt.Errorf("script must export an object, got %T", v))
+	}
+	for _, k := range objectKeys(node) {
+		if k == "props" {
+			defs, err := toPropDefs(decl[k], objectProperty(node, k))
+			if err != nil {
+				return parser.NewError(pos, err)
+			}
+			c.props = defs
+			continue
+		}
+		err := c.setOption(k, decl[k])
+		if err != nil {
+			return parser.NewError(pos, err)
+		}
+	}
+	return nil
+}
+
+// scoped样式使用的属性名, 如 data-v-7a3c2f01
+// 由组件名计算, 没有组件名的模板(RenderTpl)使用文件名或源码计算, 避免不同的模板使用相同的属性
+func (c *compiler) scopeAttr() string {
+	key := c.component
+	if key == "" && c.src != nil {
+		key = c.src.Name
+		if key == "" {
+			key = c.src.Text
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return fmt.Sprintf("data-v-%08x", h.Sum32())
+}
+
+// 给组件模板中的所有元素添加scoped属性.
+// 调用其他组件时也会添加, 由于data-开头的属性会被传递给子组件的根节点, 所以子组件的根节点也能被父组件的样式选中.
+func addScopeAttr(n *parser.Node, attr string) {
+	for _, c := range n.Child {
+		if c.NodeType != parser.ElementNode {
+			continue
+		}
+		switch c.Tag {
+		case "template", "slot", "parallel", "block", "super", "vpl-styles", "vpl-outlet", "vpl-head", "teleport":
+		default:
+			if !hasAttr(c, attr) {
+				c.Attrs = append(c.Attrs, parser.Attr{Key: attr, ValPos: c.Pos})
+			}
+		}
+		addScopeAttr(c, attr)
+	}
+}
+
+// 在css的每个选择器上添加属性选择器, 如 .a .b:hover => .a .b[data-v-x]:hover.
+// @media/@supports中的规则同样会被处理, @keyframes/@font-face等则保持不变.
+func scopeCSS(css string, attr string) string {
+	var b strings.Builder
+	scopeRules(&b, css, "["+attr+"]")
+	return b.String()
+}
+
+// 包含规则的@规则
+var nestedAtRules = map[string]bool{
+	"media":     true,
+	"supports":  true,
+	"document":  true,
+	"layer":     true,
+	"container": true,
+}
+
+func scopeRules(b *strings.Builder, css string, attr string) {
+	for len(css) != 0 {
+		// 注释与空白原样保留
+		if strings.HasPrefix(css, "/*") {
+			end := strings.Index(css[2:], "*/")
+			if end == -1 {
+				b.WriteString(css)
+				return
+			}
+			b.WriteString(css[:end+4])
+			css = css[end+4:]
+			continue
+		}
+		if strings.TrimLeft(css[:1], " \t\r\n") == "" {
+			b.WriteByte(css[0])
+			css = css[1:]
+			continue
+		}
+
+		open := indexOutside(css, "{;")
+		if open == -1 {
+			b.WriteString(css)
+			return
+		}
+		prelude := css[:open]
+		if css[open] == ';' {
+			// @import等没有块的规则
+			b.WriteString(css[:open+1])
+			css = css[open+1:]
+			continue
+		}
+		end := matchBrace(css, open)
+		body := css[open+1 : end]
+
+		if strings.HasPrefix(prelude, "@") {
+			name := strings.TrimPrefix(strings.Fields(prelude)[0], "@")
+			b.WriteString(prelude)
+			b.WriteByte('{')
+			if nestedAtRules[strings.ToLower(name)] {
+				scopeRules(b, body, attr)
+			} else {
+				b.WriteString(body)
+			}
+		} else {
+			b.WriteString(scopeSelectors(prelude, attr))
+			b.WriteByte('{')
+			b.WriteString(body)
+		}
+		if end < len(css) {
+			b.WriteByte('}')
+			css = css[end+1:]
+		} else {
+			css = ""
+		}
+	}
+}
+
+// 返回s中第一个不在字符串/括号中的chars之一的位置
+func indexOutside(s string, chars string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')' || ch == ']':
+			depth--
+		case depth == 0 && strings.IndexByte(chars, ch) != -1:
+			return i
+		}
+	}
+	return -1
+}
+
+// 返回与s[open]处的'{'匹配的'}'的位置, 没有匹配时返回len(s)
+func matchBrace(s string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '{':
+			depth++
+		case ch == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+func scopeSelectors(prelude string, attr string) string {
+	// 保留选择器与'{'之间的空白
+	trimmed := strings.TrimRight(prelude, " \t\r\n")
+	space := prelude[len(trimmed):]
+
+	var ss []string
+	for len(trimmed) != 0 {
+		i := indexOutside(trimmed, ",")
+		if i == -1 {
+			ss = append(ss, scopeSelector(trimmed, attr))
+			break
+		}
+		ss = append(ss, scopeSelector(trimmed[:i], attr))
+		trimmed = trimmed[i+1:]
+	}
+	return strings.Join(ss, ",") + space
+}
+
+// 在最后一个复合选择器的伪类之前添加属性选择器
+func scopeSelector(sel string, attr string) string {
+	trimmed := strings.TrimLeft(sel, " \t\r\n")
+	lead := sel[:len(sel)-len(trimmed)]
+	sel = strings.TrimRight(trimmed, " \t\r\n")
+
+	// 最后一个复合选择器的开始位置
+	start := 0
+	for {
+		i := indexOutside(sel[start:], " \t\r\n>+~")
+		if i == -1 {
+			break
+		}
+		start += i + 1
+	}
+	last := sel[start:]
+	insert := len(last)
+	if i := indexOutside(last, ":"); i != -1 {
+		insert = i
+	}
+	return lead + sel[:start] + last[:insert] + attr + last[insert:]
+}
@@ -3,11 +3,15 @@ package vpl
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/file"
+	ottoParser "github.com/robertkrimen/otto/parser"
 	"github.com/zbysir/vpl/internal/lib/log"
 	"github.com/zbysir/vpl/internal/parser"
 	"github.com/zbysir/vpl/internal/util"
+	"reflect"
 	"strings"
 	"sync"
 )
@@ -53,6 +57,21 @@ func (s *Scope) GetDeep(k ...string) (v interface{}) {
 	return
 }
 
+// Lookup 获取作用域中的变量(会向上查找), exist表示变量是否在某一层作用域中声明
+func (s *Scope) Lookup(k string) (v interface{}, exist bool) {
+	curr := s
+	for curr != nil {
+		v, rootExist, _ := ShouldLookInterface(curr.Value, k)
+		if rootExist {
+			return v, true
+		}
+
+		curr = curr.Parent
+	}
+
+	return nil, false
+}
+
 func (s *Scope) Extend(data map[string]interface{}) *Scope {
 	return &Scope{
 		Parent: s,
@@ -73,6 +92,12 @@ func (s *Scope) Set(k string, v interface{}) {
 type RenderCtx struct {
 	Scope *Scope // 当前作用域, 用于向当前作用域声明一个值
 	Store Store  // 用于共享数据, 此Store是RenderParam中传递的Store
+	// 本次渲染的context(RenderParam.Ctx), 可以将其传递给下游调用, 以便在渲染取消时一同取消
+	Ctx context.Context
+
+	errorMode ErrorMode
+	strict    bool
+	methods   func(t reflect.Type, name string) bool
 }
 
 type Directive func(ctx *RenderCtx, nodeData *NodeData, binding *DirectivesBinding)
@@ -116,9 +141,9 @@ func (r propsC) String() string {
 	return str
 }
 
-func (r propsC) execTo(ctx *RenderCtx, ps *Props) {
+func (r propsC) execTo(ctx *RenderCtx, ps *Props) error {
 	if len(r) == 0 {
-		return
+		return nil
 	}
 
 	for _, p := range r {
@@ -127,22 +152,31 @@ func (r propsC) execTo(ctx *RenderCtx, ps *Props) {
 			c = CanBeAttr
 		}
 
+		prop, err := p.exec(ctx)
+		if err != nil {
+			return err
+		}
+
 		ps.append(&PropKeys{
 			AttrWay: c,
 			Key:     p.Key,
-		}, p.exec(ctx).Val)
+		}, prop.Val)
 	}
-	return
+	return nil
 }
 
-func (r *propC) exec(ctx *RenderCtx) *Prop {
+func (r *propC) exec(ctx *RenderCtx) (*Prop, error) {
 	if r == nil {
-		return &Prop{}
+		return &Prop{}, nil
 	}
 	if r.IsStatic {
-		return &Prop{Key: r.Key, Val: r.ValStatic}
+		return &Prop{Key: r.Key, Val: r.ValStatic}, nil
 	} else {
-		return &Prop{Key: r.Key, Val: r.Val.Exec(ctx)}
+		v, err := r.Val.Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Prop{Key: r.Key, Val: v}, nil
 	}
 }
 
@@ -329,13 +363,33 @@ func (r *Props) appendProps(ps *Props) {
 	})
 }
 
+// 返回去掉了key的新Props
+func (r *Props) omit(key string) *Props {
+	n := NewProps()
+	r.ForEach(func(index int, k *PropKeys, v interface{}) {
+		if k.Key != key {
+			n.append(k, v)
+		}
+	})
+	return n
+}
+
+// 修改prop的值, 不存在时添加到最后
+func (r *Props) set(k string, v interface{}) {
+	if _, exist := r.data[k]; exist {
+		r.data[k] = v
+		return
+	}
+	r.Append(k, v)
+}
+
 func (r *Props) Get(key string) (interface{}, bool) {
 	v, exist := r.data[key]
 	return v, exist
 }
 
 // 如果 style和class动态与静态不冲突 ,并且沒有指令, 则可以将静态style/class优化为 string
-func compileProps(p parser.Props, staticProp bool) (propsC, error) {
+func (c *compiler) compileProps(p parser.Props, staticProp bool) (propsC, error) {
 	pc := make(propsC, len(p))
 	hasBindStyle := false
 	hasBindClass := false
@@ -358,7 +412,7 @@ func compileProps(p parser.Props, staticProp bool) (propsC, error) {
 			}
 		}
 
-		p, err := compileProp(v, static)
+		p, err := c.compileProp(v, static)
 		if err != nil {
 			return nil, err
 		}
@@ -367,7 +421,7 @@ func compileProps(p parser.Props, staticProp bool) (propsC, error) {
 	return pc, nil
 }
 
-func compileProp(p *parser.Prop, staticProp bool) (*propC, error) {
+func (c *compiler) compileProp(p *parser.Prop, staticProp bool) (*propC, error) {
 	if p == nil {
 		return nil, nil
 	}
@@ -393,11 +447,11 @@ func compileProp(p *parser.Prop, staticProp bool) (*propC, error) {
 		}
 	} else {
 		if p.ValCode != "" {
-			node, err := compileJS(p.ValCode)
+			exp, err := c.compileExpression(p.ValCode, "v-bind:"+p.Key, p.Pos)
 			if err != nil {
-				return nil, fmt.Errorf("parseJs err: %w", err)
+				return nil, err
 			}
-			pc.Val = &jsExpression{node: node, code: p.ValCode}
+			pc.Val = exp
 		} else {
 			pc.Val = &nullExpression{}
 		}
@@ -406,7 +460,7 @@ func compileProp(p *parser.Prop, staticProp bool) (*propC, error) {
 	return pc, nil
 }
 
-func compileVBind(v *parser.VBind) (*vBindC, error) {
+func (c *compiler) compileVBind(v *parser.VBind) (*vBindC, error) {
 	if v == nil {
 		return nil, nil
 	}
@@ -415,28 +469,28 @@ func compileVBind(v *parser.VBind) (*vBindC, error) {
 		return nil, nil
 	}
 
-	node, err := compileJS(v.Val)
+	exp, err := c.compileExpression(v.Val, "v-bind", v.Pos)
 	if err != nil {
-		return nil, fmt.Errorf("parseJs err: %w", err)
+		return nil, err
 	}
 
-	return &vBindC{val: &jsExpression{node: node, code: v.Val}}, nil
+	return &vBindC{val: exp}, nil
 }
 
-func compileDirective(ds parser.Directives) (directivesC, error) {
+func (c *compiler) compileDirective(ds parser.Directives) (directivesC, error) {
 	if len(ds) == 0 {
 		return nil, nil
 	}
 
 	pc := make(directivesC, len(ds))
 	for i, v := range ds {
-		node, err := compileJS(v.Value)
+		exp, err := c.compileExpression(v.Value, "v-"+v.Name, v.Pos)
 		if err != nil {
-			return nil, fmt.Errorf("parseJs err: %w", err)
+			return nil, err
 		}
 		pc[i] = directiveC{
 			Name:  v.Name,
-			Value: &jsExpression{node: node, code: v.Value},
+			Value: exp,
 			Arg:   v.Arg,
 		}
 	}
@@ -471,54 +525,75 @@ type directivesC []directiveC
 // 组件的属性
 type ComponentStruct = tagStruct
 
-
 // VBind 语法, 一次传递多个prop
 // v-bind='{id: id, 'other-attr': otherAttr}'
 // 有一个特殊用法:
 //  v-bind='$props': 将父组件所有的 props(不包括class和style) 一起传给子组件
 type vBindC struct {
 	useProps bool
+	// 组件的root节点自动继承$attrs
+	useAttrs bool
 	val      expression
 }
 
-func (v *vBindC) execTo(ctx *RenderCtx, ps *Props) {
+func (v *vBindC) execTo(ctx *RenderCtx, ps *Props) error {
 	if v == nil {
-		return
+		return nil
 	}
-	var b interface{}
-	if v.useProps {
-		b = ctx.Scope.Get("$props")
-	} else {
-		b = v.val.Exec(ctx)
+	b, err := v.exec(ctx)
+	if err != nil {
+		return err
 	}
 	switch t := b.(type) {
+	case nil:
 	case map[string]interface{}:
 		ps.AppendMap(t)
 	case skipMarshalMap:
 		ps.AppendMap(t)
+	case attrsMap:
+		for _, k := range util.GetSortedKey(t) {
+			ps.append(&PropKeys{AttrWay: CanBeAttr, Key: k}, t[k])
+		}
 	case *Props:
 		ps.appendProps(t)
 	default:
-		panic(fmt.Sprintf("bad Type of Vbind: %T", b))
+		return v.typeError(ctx, b)
 	}
+
+	return nil
 }
 
-func (v *vBindC) exec(ctx *RenderCtx) interface{} {
+func (v *vBindC) exec(ctx *RenderCtx) (interface{}, error) {
 	if v == nil {
-		return nil
+		return nil, nil
 	}
 	if v.useProps {
-		return ctx.Scope.Get("$props")
+		return ctx.Scope.Get("$props"), nil
+	} else if v.useAttrs {
+		return ctx.Scope.Get("$attrs"), nil
 	} else {
 		return v.val.Exec(ctx)
 	}
+}
 
+// v-bind的值不是对象时的错误, 在宽松模式下会被忽略
+func (v *vBindC) typeError(ctx *RenderCtx, b interface{}) error {
+	err := fmt.Errorf("bad Type of Vbind: %T", b)
+	if e, ok := v.val.(*jsExpression); ok {
+		err = e.newError(err)
+	}
+	if ctx.errorMode == ErrorModeLenient {
+		log.Warningf("%v", err)
+		return nil
+	}
+
+	return err
 }
 
 // 表达式, 所有js表达式都会被预编译成为expression
 type expression interface {
 	// 根据scope计算表达式值
-	Exec(ctx *RenderCtx) interface{}
+	Exec(ctx *RenderCtx) (interface{}, error)
 }
 
 // 原始值
@@ -530,8 +605,8 @@ func (r *rawExpression) String() string {
 	return fmt.Sprintf("%v", r.raw)
 }
 
-func (r *rawExpression) Exec(*RenderCtx) interface{} {
-	return r.raw
+func (r *rawExpression) Exec(*RenderCtx) (interface{}, error) {
+	return r.raw, nil
 }
 
 func newRawExpression(raw interface{}) *rawExpression {
@@ -541,16 +616,40 @@ func newRawExpression(raw interface{}) *rawExpression {
 type jsExpression struct {
 	node ast.Node
 	code string
+
+	// 在出错时用于提示
+	statement string         // 表达式所在的语句
+	component string         // 表达式所在的组件
+	src       *parser.Source // 表达式所在的源码
+	pos       int            // 表达式在源码中的偏移量
 }
 
-func (r *jsExpression) Exec(ctx *RenderCtx) interface{} {
+func (r *jsExpression) Exec(ctx *RenderCtx) (interface{}, error) {
 	v, err := runJsExpression(r.node, ctx)
 	if err != nil {
-		log.Warningf("runJsExpression err:%v", err)
-		return err
+		err = r.newError(err)
+		if ctx.errorMode == ErrorModeLenient {
+			log.Warningf("%v", err)
+			return "", nil
+		}
+		return nil, err
 	}
 
-	return v
+	return v, nil
+}
+
+func (r *jsExpression) newError(err error) *RenderError {
+	e := &RenderError{
+		Component: r.component,
+		Statement: r.statement,
+		Code:      r.code,
+		Err:       err,
+	}
+	if r.src != nil {
+		e.Pos = r.src.Position(r.pos)
+		e.Snippet = r.src.Snippet(r.pos)
+	}
+	return e
 }
 
 func (r *jsExpression) String() string {
@@ -560,8 +659,69 @@ func (r *jsExpression) String() string {
 type nullExpression struct {
 }
 
-func (r *nullExpression) Exec(*RenderCtx) interface{} {
-	return nil
+func (r *nullExpression) Exec(*RenderCtx) (interface{}, error) {
+	return nil, nil
+}
+
+// ErrorMode 决定渲染期间表达式出错时的处理方式
+type ErrorMode uint8
+
+const (
+	// 中断渲染, RenderComponent/RenderTpl将返回*RenderError
+	ErrorModeAbort ErrorMode = iota
+	// 忽略错误并打印日志, 出错的表达式的值为空字符串
+	ErrorModeLenient
+)
+
+// ErrComponentNotFound 在严格模式下调用了不存在的组件时返回
+var ErrComponentNotFound = errors.New("component not found")
+
+// ErrUndefinedVariable 在严格模式下使用了未定义的变量时返回
+var ErrUndefinedVariable = errors.New("undefined variable")
+
+// ErrorList 包含多个错误, 如CheckComponents找到的所有不存在的组件
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	s := make([]string, len(l))
+	for i, e := range l {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Position 是模板中的位置(文件名:行:列)
+type Position = parser.Position
+
+// CompileError 是编译模板出错时返回的错误, 包含出错的位置与代码片段
+type CompileError = parser.Error
+
+// RenderError 是渲染期间表达式执行出错(包括不支持的语法与方法panic)时返回的错误
+type RenderError struct {
+	Component string   // 表达式所在的组件, 使用RenderTpl渲染时为空
+	Statement string   // 表达式所在的语句, 如 {{}}/v-if/v-for/v-bind:id
+	Code      string   // 表达式源码
+	Pos       Position // 表达式在模板中的位置
+	Snippet   string   // 表达式所在的代码行
+	Err       error
+}
+
+func (e *RenderError) Error() string {
+	s := fmt.Sprintf("%s %q: %v", e.Statement, e.Code, e.Err)
+	if e.Component != "" {
+		s = fmt.Sprintf("component %s: %s", e.Component, s)
+	}
+	if e.Pos.Line != 0 {
+		s = fmt.Sprintf("%s: %s", e.Pos, s)
+	}
+	if e.Snippet != "" {
+		s += "\n" + e.Snippet
+	}
+	return s
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
 }
 
 // vue语法会被编译成一组Statement
@@ -581,11 +741,12 @@ type Writer interface {
 	WriteSpan(Span)
 	// 如果是同步计算, 使用WriteString会将string结果直接存储或者拼接
 	WriteString(string)
-	Result() string
+	// 返回所有内容, 如果有span出错, 则返回第一个错误
+	Result() (string, error)
 }
 
 type Span interface {
-	Result() string
+	Result() (string, error)
 }
 
 // 静态字符串块
@@ -612,7 +773,8 @@ type tagStatement struct {
 }
 
 // 执行map格式的props(来至v-bind语法)
-func execBindProps(t map[string]interface{}, ctx *StatementCtx, attrKeys *[]string, attr *map[string]string, class *strings.Builder, style *map[string]interface{}) {
+// canBeAttr判断除了class/style之外的属性是否能被渲染
+func execBindProps(t map[string]interface{}, canBeAttr func(k string) bool, attrKeys *[]string, attr *map[string]string, class *strings.Builder, style *map[string]interface{}) {
 	keys := util.GetSortedKey(t)
 
 	for _, k := range keys {
@@ -639,7 +801,7 @@ func execBindProps(t map[string]interface{}, ctx *StatementCtx, attrKeys *[]stri
 				(*attr)["style"] = ""
 			}
 		} else {
-			if ctx.CanBeAttrsKey(k) {
+			if canBeAttr(k) {
 				if _, exist := (*attr)[k]; !exist {
 					*attrKeys = append(*attrKeys, k)
 				}
@@ -674,7 +836,11 @@ func (t *tagStruct) ExecAttr(ctx *StatementCtx, rCtx *RenderCtx) error {
 					ctx.W.WriteString(p.ValStatic)
 					ctx.W.WriteString(`"`)
 				} else {
-					writeClass(p.Val.Exec(rCtx), &class)
+					v, err := p.Val.Exec(rCtx)
+					if err != nil {
+						return err
+					}
+					writeClass(v, &class)
 					if _, exist := attr["class"]; !exist {
 						attrKeys = append(attrKeys, "class")
 						attr["class"] = ""
@@ -686,7 +852,11 @@ func (t *tagStruct) ExecAttr(ctx *StatementCtx, rCtx *RenderCtx) error {
 					ctx.W.WriteString(p.ValStatic)
 					ctx.W.WriteString(`"`)
 				} else {
-					switch t := p.Val.Exec(rCtx).(type) {
+					v, err := p.Val.Exec(rCtx)
+					if err != nil {
+						return err
+					}
+					switch t := v.(type) {
 					case map[string]interface{}:
 						if style == nil {
 							style = t
@@ -710,7 +880,10 @@ func (t *tagStruct) ExecAttr(ctx *StatementCtx, rCtx *RenderCtx) error {
 						attr[p.Key] = p.ValStatic
 					}
 				} else {
-					v := p.Val.Exec(rCtx)
+					v, err := p.Val.Exec(rCtx)
+					if err != nil {
+						return err
+					}
 					if _, exist := attr[p.Key]; !exist {
 						attrKeys = append(attrKeys, p.Key)
 					}
@@ -728,17 +901,24 @@ func (t *tagStruct) ExecAttr(ctx *StatementCtx, rCtx *RenderCtx) error {
 
 	// 可能需要将 props和vBind中重复的attr去重
 	if t.VBind != nil {
-		var b = t.VBind.exec(rCtx)
-		switch t := b.(type) {
+		b, err := t.VBind.exec(rCtx)
+		if err != nil {
+			return err
+		}
+		switch bt := b.(type) {
 		case nil:
 		case map[string]interface{}:
-			execBindProps(t, ctx, &attrKeys, &attr, &class, &style)
+			execBindProps(bt, ctx.CanBeAttrsKey, &attrKeys, &attr, &class, &style)
 		case skipMarshalMap:
-			execBindProps(t, ctx, &attrKeys, &attr, &class, &style)
+			execBindProps(bt, ctx.CanBeAttrsKey, &attrKeys, &attr, &class, &style)
+		case attrsMap:
+			execBindProps(bt, alwaysAttr, &attrKeys, &attr, &class, &style)
 		case *Props:
-			execBindProps(t.ToMap(), ctx, &attrKeys, &attr, &class, &style)
+			execBindProps(bt.ToMap(), ctx.CanBeAttrsKey, &attrKeys, &attr, &class, &style)
 		default:
-			panic(fmt.Sprintf("bad Type of Vbind: %T", b))
+			if err := t.VBind.typeError(rCtx, b); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -789,9 +969,7 @@ func (t *tagStruct) ExecAttr(ctx *StatementCtx, rCtx *RenderCtx) error {
 }
 
 func (t *tagStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
-	rCtx := ctxPool.Get().(*RenderCtx)
-	rCtx.Store = ctx.Store
-	rCtx.Scope = o.Scope
+	rCtx := ctx.getRenderCtx(o.Scope)
 	defer ctxPool.Put(rCtx)
 
 	ctx.W.WriteString("<" + t.tag)
@@ -812,12 +990,18 @@ func (t *tagStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
 			props = NewProps()
 
 			if len(t.tagStruct.Props) != 0 {
-				t.tagStruct.Props.execTo(rCtx, props)
+				err := t.tagStruct.Props.execTo(rCtx, props)
+				if err != nil {
+					return err
+				}
 			}
 
 			// v-bind="{id: 1}" 语法, 将计算出整个PropsR
 			if t.tagStruct.VBind != nil {
-				t.tagStruct.VBind.execTo(rCtx, props)
+				err := t.tagStruct.VBind.execTo(rCtx, props)
+				if err != nil {
+					return err
+				}
 			}
 		}
 
@@ -830,7 +1014,10 @@ func (t *tagStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
 			Props: props,
 			Slots: slots,
 		}
-		execDirectives(t.tagStruct.Directives, ctx, o.Scope, data)
+		err := execDirectives(t.tagStruct.Directives, ctx, o.Scope, data)
+		if err != nil {
+			return err
+		}
 		props = data.Props
 		slots = data.Slots
 
@@ -920,14 +1107,15 @@ func (t *tagStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
 	return nil
 }
 
-func execDirectives(ds directivesC, ctx *StatementCtx, scope *Scope, o *NodeData) {
-	rCtx := ctxPool.Get().(*RenderCtx)
-	rCtx.Store = ctx.Store
-	rCtx.Scope = scope
+func execDirectives(ds directivesC, ctx *StatementCtx, scope *Scope, o *NodeData) error {
+	rCtx := ctx.getRenderCtx(scope)
 	defer ctxPool.Put(rCtx)
 
 	for _, v := range ds {
-		val := v.Value.Exec(rCtx)
+		val, err := v.Value.Exec(rCtx)
+		if err != nil {
+			return err
+		}
 		d, exist := ctx.Directives[v.Name]
 		if exist {
 			d(
@@ -942,6 +1130,8 @@ func execDirectives(ds directivesC, ctx *StatementCtx, scope *Scope, o *NodeData
 		}
 
 	}
+
+	return nil
 }
 
 type Class = parser.Class
@@ -1020,11 +1210,12 @@ type elseStatement struct {
 }
 
 func (i *ifStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
-	rCtx := ctxPool.Get().(*RenderCtx)
-	rCtx.Store = ctx.Store
-	rCtx.Scope = o.Scope
+	rCtx := ctx.getRenderCtx(o.Scope)
 	defer ctxPool.Put(rCtx)
-	r := i.condition.Exec(rCtx)
+	r, err := i.condition.Exec(rCtx)
+	if err != nil {
+		return err
+	}
 	if util.InterfaceToBool(r) {
 		err := i.ChildStatement.Exec(ctx, o)
 		if err != nil {
@@ -1041,7 +1232,11 @@ func (i *ifStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
 				}
 				break
 			}
-			if util.InterfaceToBool(ef.condition.Exec(rCtx)) {
+			r, err := ef.condition.Exec(rCtx)
+			if err != nil {
+				return err
+			}
+			if util.InterfaceToBool(r) {
 				err := ef.ChildStatement.Exec(ctx, o)
 				if err != nil {
 					return err
@@ -1055,25 +1250,76 @@ func (i *ifStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
 }
 
 type forStatement struct {
-	ArrayKey    string
-	Array       expression
-	ItemKey     string
-	IndexKey    string
+	ArrayKey string
+	Array    expression
+	ItemKey  string
+	// 遍历数组时是下标, 遍历对象时是key
+	IndexKey string
+	// (value, key, index) in object 中的index
+	KeyIndexKey string
 	ChildChunks Statement
+	// 列表为空时渲染的v-else
+	Else Statement
+	// 子节点中使用了$loop
+	loop bool
+}
+
+// v-for中的$loop变量, 与jinja的loop类似
+func loopVars(index int, length int, parent interface{}) map[string]interface{} {
+	index1 := index + 1
+	l := map[string]interface{}{
+		"index":  index,
+		"index1": index1,
+		"first":  index == 0,
+		"last":   index1 == length,
+		// 与css的:nth-child(even)相同, 从1开始计算
+		"even":   index1%2 == 0,
+		"odd":    index1%2 == 1,
+		"parent": parent,
+	}
+	// 遍历chan时无法知道长度
+	if length >= 0 {
+		l["length"] = length
+	}
+	return l
 }
 
 func (f forStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
-	rCtx := ctxPool.Get().(*RenderCtx)
-	rCtx.Store = ctx.Store
-	rCtx.Scope = o.Scope
-	array := f.Array.Exec(rCtx)
+	rCtx := ctx.getRenderCtx(o.Scope)
+	array, err := f.Array.Exec(rCtx)
 	ctxPool.Put(rCtx)
+	if err != nil {
+		return err
+	}
 
-	return util.ForInterface(array, func(index int, v interface{}) error {
-		scope := o.Scope.Extend(map[string]interface{}{
-			f.IndexKey: index,
+	var done <-chan struct{}
+	if ctx.Ctx != nil {
+		done = ctx.Ctx.Done()
+	}
+	length := -1
+	var parent interface{}
+	if f.loop {
+		length = util.ForLen(array)
+		parent, _ = o.Scope.Lookup("$loop")
+	}
+
+	empty := true
+	err = util.ForInterface(array, done, func(index int, key interface{}, v interface{}) error {
+		empty = false
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		vars := map[string]interface{}{
+			f.IndexKey: key,
 			f.ItemKey:  v,
-		})
+		}
+		if f.KeyIndexKey != "" {
+			vars[f.KeyIndexKey] = index
+		}
+		if f.loop {
+			vars["$loop"] = loopVars(index, length, parent)
+		}
+		scope := o.Scope.Extend(vars)
 
 		err := f.ChildChunks.Exec(ctx, &StatementOptions{
 			Scope: scope,
@@ -1084,6 +1330,17 @@ func (f forStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	// 在等待chan时渲染可能被取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if empty && f.Else != nil {
+		return f.Else.Exec(ctx, o)
+	}
+	return nil
 }
 
 type groupStatement struct {
@@ -1146,6 +1403,30 @@ func (g *groupStatement) Append(st Statement) {
 type ComponentStatement struct {
 	ComponentKey    string
 	ComponentStruct ComponentStruct
+	// 组件没有注册时执行的语句, 用于将自定义元素(如<my-element>)渲染为普通标签
+	Fallback Statement
+
+	// 在出错时用于提示
+	caller string         // 调用组件的组件
+	src    *parser.Source // 调用组件的源码
+	pos    int            // 组件tag在源码中的偏移量
+
+	// 由<extends>编译而来, 需要将没有覆盖的block传递给布局, 见 forwardBlocks
+	extends bool
+}
+
+func (c *ComponentStatement) newError(err error) *RenderError {
+	e := &RenderError{
+		Component: c.caller,
+		Statement: "component",
+		Code:      c.ComponentKey,
+		Err:       err,
+	}
+	if c.src != nil {
+		e.Pos = c.src.Position(c.pos)
+		e.Snippet = c.src.Snippet(c.pos)
+	}
+	return e
 }
 
 // 调用组件语句
@@ -1153,9 +1434,13 @@ type ComponentStatement struct {
 // 根据组件attr拼接出新的scope, 再执行组件
 // 处理slot作用域
 func (c *ComponentStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
-	rCtx := ctxPool.Get().(*RenderCtx)
-	rCtx.Store = ctx.Store
-	rCtx.Scope = o.Scope
+	if c.Fallback != nil {
+		if _, exist := ctx.Components[c.ComponentKey]; !exist {
+			return c.Fallback.Exec(ctx, o)
+		}
+	}
+
+	rCtx := ctx.getRenderCtx(o.Scope)
 	defer ctxPool.Put(rCtx)
 
 	// 计算Props
@@ -1164,23 +1449,38 @@ func (c *ComponentStatement) Exec(ctx *StatementCtx, o *StatementOptions) error
 		props = NewProps()
 		// v-bind="{id: 1}" 语法, 将计算出整个PropsR
 		if c.ComponentStruct.VBind != nil {
-			c.ComponentStruct.VBind.execTo(rCtx, props)
+			err := c.ComponentStruct.VBind.execTo(rCtx, props)
+			if err != nil {
+				return err
+			}
 		}
 
 		// 如果还传递了其他props, 则覆盖
 		if c.ComponentStruct.Props != nil {
-			c.ComponentStruct.Props.execTo(rCtx, props)
+			err := c.ComponentStruct.Props.execTo(rCtx, props)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	// 处理slot作用域
 	slots := c.ComponentStruct.Slots.WrapScope(o)
+	if c.extends {
+		slots = forwardBlocks(slots, o.Slots)
+	}
 
 	cp, exist := ctx.Components[c.ComponentKey]
 	// 没有找到组件时直接渲染自身的子组件
 	if !exist {
+		if ctx.Strict {
+			return c.newError(ErrComponentNotFound)
+		}
 		ctx.W.WriteString(fmt.Sprintf(`<%s data-err="not found component"`, c.ComponentKey))
-		c.ComponentStruct.ExecAttr(ctx, rCtx)
+		err := c.ComponentStruct.ExecAttr(ctx, rCtx)
+		if err != nil {
+			return err
+		}
 		ctx.W.WriteString(`>`)
 
 		if slots != nil {
@@ -1188,7 +1488,7 @@ func (c *ComponentStatement) Exec(ctx *StatementCtx, o *StatementOptions) error
 			if child != nil {
 				err := child.Exec(ctx, nil)
 				if err != nil {
-					return nil
+					return err
 				}
 			}
 		}
@@ -1204,21 +1504,67 @@ func (c *ComponentStatement) Exec(ctx *StatementCtx, o *StatementOptions) error
 			Props: props,
 			Slots: slots,
 		}
-		execDirectives(c.ComponentStruct.Directives, ctx, o.Scope, data)
+		err := execDirectives(c.ComponentStruct.Directives, ctx, o.Scope, data)
+		if err != nil {
+			return err
+		}
 		props = data.Props
 		slots = data.Slots
 	}
 
-	//json.Marshal()
+	// 校验声明的props
+	if pc, ok := cp.(*declComponent); ok {
+		var err error
+		props, err = pc.applyProps(props)
+		if err != nil {
+			return c.newError(err)
+		}
+	}
+
+	err := execCachedComponent(ctx, c.ComponentKey, props, func(ctx *StatementCtx) error {
+		return execComponent(ctx, cp, props, slots, o)
+	})
+	if errors.Is(err, ErrComponentNotFound) || errors.Is(err, errCacheKeyPanic) {
+		// 内置组件(如动态组件<component>)中没有找到组件, 或者组件缓存的key函数出错时, 使用调用处的位置
+		var re *RenderError
+		if !errors.As(err, &re) {
+			return c.newError(err)
+		}
+	}
+	return err
+}
+
+// 执行组件, o是调用组件时的参数
+func execComponent(ctx *StatementCtx, cp Statement, props *Props, slots *Slots, o *StatementOptions) error {
+	// 只在组件与循环处检查渲染是否被取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	// 运行组件应该重新使用新的scope
 	// 和vue不同的是, props只有在子组件中申明才能在子组件中使用, 而vtpl不同, 它将所有props放置到变量域中.
 	scope := ctx.NewScope()
+	// 组件声明了props时, 只有声明的props会放置到变量域与$props中, 其他属性只在$attrs中
+	dc, _ := cp.(*declComponent)
+	var propsMap map[string]interface{}
+	if dc != nil && dc.props != nil {
+		propsMap = dc.declared(props)
+	} else {
+		propsMap = props.ToMap()
+	}
 	if props != nil {
-		propsMap := props.ToMap()
 		scope = scope.Extend(propsMap)
-		// 使用skipMarshalMap解决循环引用时Marshal报错的问题
-		scope.Set("$props", skipMarshalMap(propsMap))
+	}
+	// 使用skipMarshalMap解决循环引用时Marshal报错的问题
+	scope.Set("$props", skipMarshalMap(propsMap))
+	// $attrs是没有声明为props的属性, 组件没有声明props时与$props相同
+	if dc != nil && dc.props != nil {
+		scope.Set("$attrs", dc.attrs(props))
+	} else {
+		scope.Set("$attrs", skipMarshalMap(propsMap))
+	}
+	if dc != nil && dc.style != "" {
+		ctx.useStyle(dc.name, dc.style)
 	}
 
 	return cp.Exec(ctx, &StatementOptions{
@@ -1298,17 +1644,26 @@ func init() {
 	}}
 }
 
-func (i *mustacheStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
+// getRenderCtx 从池中取出RenderCtx, 使用完毕之后需要调用ctxPool.Put放回
+func (c *StatementCtx) getRenderCtx(scope *Scope) *RenderCtx {
 	rCtx := ctxPool.Get().(*RenderCtx)
-	rCtx.Store = ctx.Store
-	rCtx.Scope = o.Scope
-	defer ctxPool.Put(rCtx)
+	rCtx.Store = c.Store
+	rCtx.Scope = scope
+	rCtx.Ctx = c.Ctx
+	rCtx.errorMode = c.ErrorMode
+	rCtx.strict = c.Strict
+	rCtx.methods = c.methods
+	return rCtx
+}
 
-	//rCtx := &RenderCtx{
-	//	Store: ctx.Store, Scope: o.Scope,
-	//}
+func (i *mustacheStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
+	rCtx := ctx.getRenderCtx(o.Scope)
+	defer ctxPool.Put(rCtx)
 
-	r := i.exp.Exec(rCtx)
+	r, err := i.exp.Exec(rCtx)
+	if err != nil {
+		return err
+	}
 
 	ctx.W.WriteString(util.InterfaceToStr(r, true))
 	return nil
@@ -1321,12 +1676,13 @@ type rawHtmlStatement struct {
 }
 
 func (i *rawHtmlStatement) Exec(ctx *StatementCtx, o *StatementOptions) error {
-	rCtx := ctxPool.Get().(*RenderCtx)
-	rCtx.Store = ctx.Store
-	rCtx.Scope = o.Scope
+	rCtx := ctx.getRenderCtx(o.Scope)
 	defer ctxPool.Put(rCtx)
 
-	r := i.exp.Exec(rCtx)
+	r, err := i.exp.Exec(rCtx)
+	if err != nil {
+		return err
+	}
 
 	ctx.W.WriteString(util.InterfaceToStr(r, false))
 	return nil
@@ -1404,19 +1760,122 @@ func (s *Slots) Get(key string) *Slot {
 }
 
 func ParseHtmlToStatement(tpl string, options *parser.ParseVueNodeOptions) (Statement, *SlotsC, error) {
+	return compileComponent(&compiler{}, "", tpl, options)
+}
+
+// 编译组件
+// c.component是组件名, filename是模板文件名, 用于在出错时提示
+func compileComponent(c *compiler, filename string, tpl string, options *parser.ParseVueNodeOptions) (Statement, *SlotsC, error) {
+	src := &parser.Source{Name: filename, Text: tpl}
+	c.src = src
+	statement, slots, err := c.compile(tpl, options)
+	if err != nil {
+		// 如果错误包含位置信息, 则直接返回, 让错误以"文件名:行:列"开头
+		var pe *parser.Error
+		if errors.As(src.Locate(err), &pe) {
+			return nil, nil, pe
+		}
+		return nil, nil, err
+	}
+	return statement, slots, nil
+}
+
+// 编译期间的上下文
+type compiler struct {
+	component string          // 正在编译的组件名
+	src       *parser.Source  // 正在编译的源码
+	elements  map[string]bool // 覆盖默认的html元素表, 见WithElements
+	refs      []componentRef  // 静态调用的组件, 见CheckComponents
+	props     []PropDef       // <script props>中声明的props, 没有声明时为nil
+	// <script options>中声明了inheritAttrs: false
+	noInheritAttrs bool
+	// 根节点中<style>的内容
+	style string
+	// 根节点是<extends>, extendsPos是它在源码中的偏移量
+	extends    bool
+	extendsPos int
+	// 使用了$loop的表达式数量, 只有子节点中使用了$loop的v-for才需要提供$loop
+	loopRefs int
+}
+
+// 组件中对其他组件的调用
+type componentRef struct {
+	Name string
+	Pos  Position
+}
+
+func (c *compiler) compile(tpl string, options *parser.ParseVueNodeOptions) (Statement, *SlotsC, error) {
 	nt, err := parser.ParseHtml(tpl)
 	if err != nil {
 		return nil, nil, err
 	}
+	// <script props>/<style>等声明不是模板的一部分, 需要在计算根节点之前取出
+	err = c.extractBlocks(nt)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = c.compileExtends(nt)
+	if err != nil {
+		return nil, nil, err
+	}
 	vn, err := parser.ToVueNode(nt, options)
 	if err != nil {
 		return nil, nil, fmt.Errorf("parseToVue err: %w", err)
 	}
-	statement, slots, err := toStatement(vn)
+	if c.noInheritAttrs {
+		clearDistributionAttr(vn)
+	}
+	return c.toStatement(vn)
+}
+
+// 预编译js表达式
+// statement是表达式所在的语句, pos是表达式在源码中的偏移量, 用于在出错时提示
+func (c *compiler) compileExpression(code string, statement string, pos int) (*jsExpression, error) {
+	if strings.Contains(code, "$loop") {
+		c.loopRefs++
+	}
+	node, err := compileJS(code)
 	if err != nil {
-		return nil, nil, err
+		var el ottoParser.ErrorList
+		if errors.As(err, &el) && len(el) != 0 {
+			return nil, parser.NewError(pos+jsErrorOffset(code, el[0].Position), errors.New(el[0].Message))
+		}
+		return nil, parser.NewError(pos, fmt.Errorf("parseJs err: %w", err))
+	}
+
+	return &jsExpression{
+		node:      node,
+		code:      code,
+		statement: statement,
+		component: c.component,
+		src:       c.src,
+		pos:       pos,
+	}, nil
+}
+
+// 将js语法错误的行列号转为在表达式中的偏移量
+// 注意compileJS会在表达式外包裹一层括号
+func jsErrorOffset(code string, p file.Position) int {
+	offset := 0
+	for line := 1; line < p.Line; line++ {
+		i := strings.IndexByte(code[offset:], '\n')
+		if i == -1 {
+			break
+		}
+		offset += i + 1
 	}
-	return statement, slots, nil
+	offset += p.Column - 1
+	if p.Line <= 1 {
+		// 第一行的开头是"("
+		offset--
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(code) {
+		offset = len(code)
+	}
+	return offset
 }
 
 // 执行语句(组件/Tag)所需的参数
@@ -1452,6 +1911,38 @@ type StatementCtx struct {
 	Components    map[string]Statement
 	Directives    map[string]Directive
 	CanBeAttrsKey func(k string) bool
+	ErrorMode     ErrorMode
+	// 严格模式: 组件不存在或变量未定义时渲染失败
+	Strict bool
+
+	// 允许调用的go方法, 见WithMethods
+	methods func(t reflect.Type, name string) bool
+
+	// 限制parallel的并发数量, 为nil时不限制
+	parallelSem chan struct{}
+	// 一次渲染中共享的状态, 如收集的样式
+	state *renderState
+	// 当前的parallel块执行完成时调用, 见 renderState.start
+	parallelDone func()
+	// 在覆盖<block>的内容中, <super>需要渲染的内容
+	blockSuper *blockSuper
+	// v-memo的缓存, 为nil时不缓存
+	memoCache *lruCache
+	// 组件缓存, 见Vpl.CacheComponent
+	caches     map[string]*componentCache
+	cacheStore CacheStore
+	// 组件的版本, 用于区分组件重新编译之前缓存的结果, 见registry.generation
+	generation int64
+	// 正在渲染需要缓存的v-memo/v-once时, 记录其中使用的样式与推送到输出口的内容
+	memo *memoRecorder
+}
+
+// Err 返回渲染context的错误, 当渲染被取消或超时时不为nil
+func (c *StatementCtx) Err() error {
+	if c.Ctx == nil {
+		return nil
+	}
+	return c.Ctx.Err()
 }
 
 func (c *StatementCtx) NewScope() *Scope {
@@ -1467,6 +1958,48 @@ func (c *StatementCtx) Clone() *StatementCtx {
 		Components:    c.Components,
 		Directives:    c.Directives,
 		CanBeAttrsKey: c.CanBeAttrsKey,
+		ErrorMode:     c.ErrorMode,
+		Strict:        c.Strict,
+		methods:       c.methods,
+		parallelSem:   c.parallelSem,
+		state:         c.state,
+		parallelDone:  c.parallelDone,
+		blockSuper:    c.blockSuper,
+		memoCache:     c.memoCache,
+		caches:        c.caches,
+		cacheStore:    c.cacheStore,
+		generation:    c.generation,
+		memo:          c.memo,
+	}
+}
+
+// 标记当前的parallel块已经执行完成(但子span可能还在计算)
+func (c *StatementCtx) parallelExecuted() {
+	if c.parallelDone != nil {
+		c.parallelDone()
+	}
+}
+
+// 获取一个parallel的执行名额, 在渲染取消时返回错误
+func (c *StatementCtx) acquireParallel() error {
+	if c.parallelSem == nil {
+		return c.Err()
+	}
+	if c.Ctx == nil {
+		c.parallelSem <- struct{}{}
+		return nil
+	}
+	select {
+	case c.parallelSem <- struct{}{}:
+		return nil
+	case <-c.Ctx.Done():
+		return c.Ctx.Err()
+	}
+}
+
+func (c *StatementCtx) releaseParallel() {
+	if c.parallelSem != nil {
+		<-c.parallelSem
 	}
 }
 
@@ -1505,46 +2038,228 @@ func canBeStr(v *parser.VueElement) bool {
 		v.DistributionAttr == false
 }
 
-var htmlTag = map[string]struct{}{
-	"html":       {},
-	"head":       {},
-	"header":     {},
-	"footer":     {},
-	"body":       {},
-	"meta":       {},
-	"title":      {},
-	"div":        {},
-	"input":      {},
-	"p":          {},
-	"h1":         {},
-	"h2":         {},
-	"h3":         {},
-	"h4":         {},
-	"h5":         {},
-	"h6":         {},
-	"hr":         {},
-	"blockquote": {},
-	"ul":         {},
-	"li":         {},
-	"span":       {},
-	"style":      {},
-	"script":     {},
-	"link":       {},
-	"a":          {},
-	"object":     {},
-	"button":     {},
-	"img":        {},
-	"i":          {},
-	"center":     {},
-	"table":      {},
-	"tbody":      {},
-	"thead":      {},
-	"th":         {},
-	"tr":         {},
-	"td":         {},
-	"pre":        {},
-	"code":       {},
-	"br":         {},
+// 编译html标签, 子节点中的slot声明会合并到slots中
+func (c *compiler) compileTag(v *parser.VueElement, slots *SlotsC) (Statement, error) {
+	var sg groupStatement
+
+	// 如果没使用任何变量, 则是静态组件, 则编译成字符串
+	if canBeStr(v) {
+		attrs := ""
+
+		//if len(v.Class) != 0 {
+		//	attrs += v.Class.ToAttr()
+		//}
+		//
+		//if len(v.Style) != 0 {
+		//	if attrs != "" {
+		//		attrs += " "
+		//	}
+		//	attrs += v.Style.ToAttr()
+		//}
+
+		// 静态props
+		if len(v.Props) != 0 {
+			attrs += genAttrFromProps(v.Props)
+		}
+
+		if attrs != "" {
+			attrs = " " + attrs
+		}
+
+		sg.Append(&StrStatement{Str: fmt.Sprintf("<%s%s>", v.Tag, attrs)})
+
+		// 子集
+		for _, child := range v.Children {
+			s, slotsc, err := c.toStatement(child)
+			if err != nil {
+				return nil, err
+			}
+			slots.marge(slotsc)
+			sg.Append(s)
+		}
+
+		// 单标签不需要结束
+		if !parser.VoidElements[v.Tag] {
+			sg.Append(&StrStatement{Str: fmt.Sprintf("</%s>", v.Tag)})
+		}
+	} else {
+		// 动态的（依赖变量）节点渲染
+
+		//pc, err := compileProp(v.PropClass)
+		//if err != nil {
+		//	return nil, err
+		//}
+		//ps, err := compileProp(v.PropStyle)
+		//if err != nil {
+		//	return nil, err
+		//}
+
+		// 如果 style和class动态与静态不冲突 ,并且沒有指令, 则可以将静态style/class优化为 string
+		staticProp := !v.DistributionAttr && v.VBind == nil && len(v.Directives) == 0
+		p, err := c.compileProps(v.Props, staticProp)
+		if err != nil {
+			return nil, err
+		}
+
+		// 如果被自动分配attr, 那么直接继承上一层的$attrs
+		var vbind *vBindC
+		if v.DistributionAttr {
+			vbind = &vBindC{useAttrs: true}
+		} else {
+			vbind, err = c.compileVBind(v.VBind)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		dir, err := c.compileDirective(v.Directives)
+		if err != nil {
+			return nil, err
+
+		}
+
+		var childStatement Statement
+
+		if v.VHtml != "" {
+			exp, err := c.compileExpression(v.VHtml, "v-html", v.VHtmlPos)
+			if err != nil {
+				return nil, err
+			}
+			childStatement = &rawHtmlStatement{
+				exp: exp,
+			}
+		} else if v.VText != "" {
+			exp, err := c.compileExpression(v.VText, "v-text", v.VTextPos)
+			if err != nil {
+				return nil, err
+			}
+			childStatement = &mustacheStatement{
+				exp: exp,
+			}
+		} else {
+			var childStatementG groupStatement
+			for _, child := range v.Children {
+				s, slotsc, err := c.toStatement(child)
+				if err != nil {
+					return nil, err
+				}
+				slots.marge(slotsc)
+
+				childStatementG.Append(s)
+			}
+
+			childStatement = childStatementG.Finish()
+		}
+
+		// 子集 作为default slot
+		var childSlots *SlotsC
+		if childStatement != nil {
+			childSlots = &SlotsC{
+				Default: &SlotC{
+					Name:     "default",
+					propsKey: "",
+					Children: childStatement,
+				},
+				NamedSlot: nil,
+			}
+		}
+
+		sg.Append(&tagStatement{
+			tag: v.Tag,
+			tagStruct: tagStruct{
+				Props: p,
+				//PropClass:   pc,
+				//PropStyle:   ps,
+				//StaticClass: v.Class,
+				//StaticStyle: v.Style,
+				Directives: dir,
+				Slots:      childSlots,
+				VBind:      vbind,
+			},
+		})
+	}
+
+	return sg.Finish(), nil
+}
+
+// 编译自定义组件的调用, 子节点会作为组件的slot, 子节点中的slot声明也会合并到slots中
+func (c *compiler) compileComponentCall(v *parser.VueElement, slots *SlotsC) (Statement, error) {
+	var st Statement
+	var childStatement Statement
+
+	if v.VHtml != "" {
+		exp, err := c.compileExpression(v.VHtml, "v-html", v.VHtmlPos)
+		if err != nil {
+			return nil, err
+		}
+		childStatement = &rawHtmlStatement{
+			exp: exp,
+		}
+	} else if v.VText != "" {
+		exp, err := c.compileExpression(v.VText, "v-text", v.VTextPos)
+		if err != nil {
+			return nil, err
+		}
+		childStatement = &mustacheStatement{
+			exp: exp,
+		}
+	} else {
+		// 子集 作为default slot
+		var childStatementG groupStatement
+		for _, child := range v.Children {
+			s, slotsc, err := c.toStatement(child)
+			if err != nil {
+				return nil, err
+			}
+			slots.marge(slotsc)
+			childStatementG.Append(s)
+		}
+
+		childStatement = childStatementG.Finish()
+	}
+
+	if v.Tag == "template" && len(v.Directives) == 0 {
+		// 如果是template 并且没有自定义指令, 则可以简化语句
+		st = childStatement
+	} else {
+		if childStatement != nil {
+			slots.Default = &SlotC{
+				Name:     "default",
+				propsKey: "",
+				Children: childStatement,
+			}
+		}
+
+		vbind, err := c.compileVBind(v.VBind)
+		if err != nil {
+			return nil, err
+		}
+
+		dir, err := c.compileDirective(v.Directives)
+		if err != nil {
+			return nil, err
+		}
+		p, err := c.compileProps(v.Props, !v.DistributionAttr && v.VBind == nil)
+		if err != nil {
+			return nil, err
+		}
+
+		st = &ComponentStatement{
+			ComponentKey: v.Tag,
+			ComponentStruct: ComponentStruct{
+				Props:      p,
+				VBind:      vbind,
+				Directives: dir,
+				Slots:      slots,
+			},
+			caller:  c.component,
+			src:     c.src,
+			pos:     v.Pos,
+			extends: c.extends && v.Pos == c.extendsPos,
+		}
+	}
+
+	return st, nil
 }
 
 // 通过Vue树，生成运行程序
@@ -1553,7 +2268,7 @@ var htmlTag = map[string]struct{}{
 //   - 将连在一起的静态节点预渲染为字符串
 // - 预编译JS
 // 原则是将运行时消耗减到最小
-func toStatement(v *parser.VueElement) (Statement, *SlotsC, error) {
+func (c *compiler) toStatement(v *parser.VueElement) (Statement, *SlotsC, error) {
 	slots := &SlotsC{}
 	switch v.NodeType {
 	case parser.RootNode:
@@ -1561,8 +2276,8 @@ func toStatement(v *parser.VueElement) (Statement, *SlotsC, error) {
 
 		// 子集
 		var sg groupStatement
-		for _, c := range v.Children {
-			s, slotsc, err := toStatement(c)
+		for _, child := range v.Children {
+			s, slotsc, err := c.toStatement(child)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -1574,234 +2289,63 @@ func toStatement(v *parser.VueElement) (Statement, *SlotsC, error) {
 		return &StrStatement{Str: v.Text}, nil, nil
 	case parser.ElementNode:
 		var st Statement
+		// 用于判断子节点中是否使用了$loop
+		loopRefs := c.loopRefs
 
 		// 静态节点(不是自定义组件)，则走渲染tag逻辑, 否则调用渲染组件方法
-		if _, ok := htmlTag[v.Tag]; ok {
-			var sg groupStatement
-
-			// 如果没使用任何变量, 则是静态组件, 则编译成字符串
-			if canBeStr(v) {
-				attrs := ""
-
-				//if len(v.Class) != 0 {
-				//	attrs += v.Class.ToAttr()
-				//}
-				//
-				//if len(v.Style) != 0 {
-				//	if attrs != "" {
-				//		attrs += " "
-				//	}
-				//	attrs += v.Style.ToAttr()
-				//}
-
-				// 静态props
-				if len(v.Props) != 0 {
-					attrs += genAttrFromProps(v.Props)
-				}
-
-				if attrs != "" {
-					attrs = " " + attrs
-				}
-
-				sg.Append(&StrStatement{Str: fmt.Sprintf("<%s%s>", v.Tag, attrs)})
-
-				// 子集
-				for _, c := range v.Children {
-					s, slotsc, err := toStatement(c)
-					if err != nil {
-						return nil, nil, err
-					}
-					slots.marge(slotsc)
-					sg.Append(s)
-				}
-
-				// 单标签不需要结束
-				if !parser.VoidElements[v.Tag] {
-					sg.Append(&StrStatement{Str: fmt.Sprintf("</%s>", v.Tag)})
-				}
-			} else {
-				// 动态的（依赖变量）节点渲染
-
-				//pc, err := compileProp(v.PropClass)
-				//if err != nil {
-				//	return nil, nil, err
-				//}
-				//ps, err := compileProp(v.PropStyle)
-				//if err != nil {
-				//	return nil, nil, err
-				//}
-
-				// 如果 style和class动态与静态不冲突 ,并且沒有指令, 则可以将静态style/class优化为 string
-				staticProp := !v.DistributionAttr && v.VBind == nil && len(v.Directives) == 0
-				p, err := compileProps(v.Props, staticProp)
-				if err != nil {
-					return nil, nil, err
-				}
-
-				// 如果被自动分配attr, 那么直接继承上一层的props
-				var vbind *vBindC
-				if v.DistributionAttr {
-					vbind = &vBindC{useProps: true}
-				} else {
-					vbind, err = compileVBind(v.VBind)
-					if err != nil {
-						return nil, nil, err
-					}
-				}
-
-				dir, err := compileDirective(v.Directives)
-				if err != nil {
-					return nil, nil, err
-
-				}
-
-				var childStatement Statement
-
-				if v.VHtml != "" {
-					node, err := compileJS(v.VHtml)
-					if err != nil {
-						return nil, nil, err
-					}
-					childStatement = &rawHtmlStatement{
-						exp: &jsExpression{node: node, code: v.VHtml},
-					}
-				} else if v.VText != "" {
-					node, err := compileJS(v.VText)
-					if err != nil {
-						return nil, nil, err
-					}
-					childStatement = &mustacheStatement{
-						exp: &jsExpression{node: node, code: v.VText},
-					}
-				} else {
-					var childStatementG groupStatement
-					for _, c := range v.Children {
-						s, slotsc, err := toStatement(c)
-						if err != nil {
-							return nil, nil, err
-						}
-						slots.marge(slotsc)
-
-						childStatementG.Append(s)
-					}
-
-					childStatement = childStatementG.Finish()
-				}
-
-				// 子集 作为default slot
-				var slots *SlotsC
-				if childStatement != nil {
-					slots = &SlotsC{
-						Default: &SlotC{
-							Name:     "default",
-							propsKey: "",
-							Children: childStatement,
-						},
-						NamedSlot: nil,
-					}
-				}
-
-				sg.Append(&tagStatement{
-					tag: v.Tag,
-					tagStruct: tagStruct{
-						Props: p,
-						//PropClass:   pc,
-						//PropStyle:   ps,
-						//StaticClass: v.Class,
-						//StaticStyle: v.Style,
-						Directives: dir,
-						Slots:      slots,
-						VBind:      vbind,
-					},
-				})
+		if c.isElement(v.Tag) && !c.canBeComponent(v.Tag) {
+			s, err := c.compileTag(v, slots)
+			if err != nil {
+				return nil, nil, err
 			}
-
-			st = sg.Finish()
+			st = s
 		} else {
-			// 自定义组件
-			var childStatement Statement
-
-			if v.VHtml != "" {
-				node, err := compileJS(v.VHtml)
-				if err != nil {
-					return nil, nil, err
-				}
-				childStatement = &rawHtmlStatement{
-					exp: &jsExpression{node: node, code: v.VHtml},
-				}
-			} else if v.VText != "" {
-				node, err := compileJS(v.VText)
-				if err != nil {
-					return nil, nil, err
-				}
-				childStatement = &mustacheStatement{
-					exp: &jsExpression{node: node, code: v.VText},
-				}
-			} else {
-				// 子集 作为default slot
-				var childStatementG groupStatement
-				for _, c := range v.Children {
-					s, slotsc, err := toStatement(c)
-					if err != nil {
-						return nil, nil, err
-					}
-					slots.marge(slotsc)
-					childStatementG.Append(s)
-				}
-
-				childStatement = childStatementG.Finish()
+			s, err := c.compileComponentCall(v, slots)
+			if err != nil {
+				return nil, nil, err
 			}
+			st = s
 
-			if v.Tag == "template" && len(v.Directives) == 0 {
-				// 如果是template 并且没有自定义指令, 则可以简化语句
-				st = childStatement
-			} else {
-				if childStatement != nil {
-					slots.Default = &SlotC{
-						Name:     "default",
-						propsKey: "",
-						Children: childStatement,
-					}
-				}
-
-				vbind, err := compileVBind(v.VBind)
-				if err != nil {
-					return nil, nil, err
-				}
-
-				dir, err := compileDirective(v.Directives)
-				if err != nil {
-					return nil, nil, err
-				}
-				p, err := compileProps(v.Props, !v.DistributionAttr && v.VBind == nil)
+			// 自定义元素(名字中包含"-")与html元素在没有注册为组件时作为普通标签渲染
+			if cs, ok := s.(*ComponentStatement); ok && (c.isCustomElement(v.Tag) || c.isElement(v.Tag)) {
+				// 子节点已经在组件调用中编译过, 其中调用的组件不需要重复记录
+				refs := len(c.refs)
+				fallback, err := c.compileTag(v, &SlotsC{})
 				if err != nil {
 					return nil, nil, err
 				}
-
-				st = &ComponentStatement{
-					ComponentKey: v.Tag,
-					ComponentStruct: ComponentStruct{
-						Props:      p,
-						VBind:      vbind,
-						Directives: dir,
-						Slots:      slots,
-					},
+				c.refs = c.refs[:refs]
+				cs.Fallback = fallback
+			} else if ok {
+				var pos Position
+				if c.src != nil {
+					pos = c.src.Position(v.Pos)
 				}
+				c.refs = append(c.refs, componentRef{Name: v.Tag, Pos: pos})
 			}
 
 			// 如果调用了自定义组件, 则slots就算这个自定义组件当中, 而不算在父级当中.
 			slots = &SlotsC{}
 		}
 
+		// v-memo在v-if与v-for之内, 每次循环分别缓存
+		if v.VMemo != nil {
+			s, err := c.compileMemo(v, st)
+			if err != nil {
+				return nil, nil, err
+			}
+			st = s
+		}
+
 		if v.VIf != nil {
-			ifCondition, err := compileJS(v.VIf.Condition)
+			ifCondition, err := c.compileExpression(v.VIf.Condition, "v-if", v.VIf.Pos)
 			if err != nil {
 				return nil, nil, err
 			}
 			// 解析else节点
 			elseIfStatements := make([]*elseStatement, len(v.VIf.ElseIf))
 			for i, f := range v.VIf.ElseIf {
-				st, slotsc, err := toStatement(f.VueElement)
+				st, slotsc, err := c.toStatement(f.VueElement)
 				if err != nil {
 					return nil, nil, err
 				}
@@ -1814,19 +2358,19 @@ func toStatement(v *parser.VueElement) (Statement, *SlotsC, error) {
 				}
 
 				if f.Types == "elseif" && f.Condition != "" {
-					n, err := compileJS(f.Condition)
+					condition, err := c.compileExpression(f.Condition, "v-else-if", f.Pos)
 					if err != nil {
 						return nil, nil, err
 					}
 
-					s.condition = &jsExpression{node: n, code: f.Condition}
+					s.condition = condition
 				}
 
 				elseIfStatements[i] = s
 			}
 
 			st = &ifStatement{
-				condition:      &jsExpression{node: ifCondition, code: v.VIf.Condition},
+				condition:      ifCondition,
 				conditionCode:  v.VIf.Condition,
 				ChildStatement: st,
 				ElseIf:         elseIfStatements,
@@ -1834,18 +2378,30 @@ func toStatement(v *parser.VueElement) (Statement, *SlotsC, error) {
 		}
 
 		if v.VFor != nil {
-			p, err := compileJS(v.VFor.ArrayKey)
+			loop := c.loopRefs != loopRefs
+			array, err := c.compileExpression(v.VFor.ArrayKey, "v-for", v.VFor.Pos)
 			if err != nil {
 				return nil, nil, err
 			}
 
-			st = &forStatement{
+			fs := &forStatement{
 				ArrayKey:    v.VFor.ArrayKey,
-				Array:       &jsExpression{node: p, code: v.VFor.ArrayKey},
+				Array:       array,
 				ItemKey:     v.VFor.ItemKey,
 				IndexKey:    v.VFor.IndexKey,
+				KeyIndexKey: v.VFor.KeyIndexKey,
 				ChildChunks: st,
+				loop:        loop,
 			}
+			if v.VFor.Else != nil {
+				es, slotsc, err := c.toStatement(v.VFor.Else)
+				if err != nil {
+					return nil, nil, err
+				}
+				slots.marge(slotsc)
+				fs.Else = es
+			}
+			st = fs
 		}
 
 		if v.VSlot != nil {
@@ -1872,7 +2428,7 @@ func toStatement(v *parser.VueElement) (Statement, *SlotsC, error) {
 
 		return st, slots, nil
 	case parser.TextNode:
-		s, err := parseBeard(v.Text)
+		s, err := c.parseBeard(v.Text, v.Pos)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -1886,11 +2442,19 @@ func toStatement(v *parser.VueElement) (Statement, *SlotsC, error) {
 }
 
 // 将胡子语法处理成多个语句
-func parseBeard(txt string) (Statement, error) {
+// pos是txt在源码中的偏移量
+func (c *compiler) parseBeard(txt string, pos int) (Statement, error) {
 	var sg groupStatement
 
 	if strings.Contains(txt, "{{") {
+		// 当前片段在源码中的偏移量
+		offset := pos
 		for index, v := range strings.Split(txt, "{{") {
+			if index != 0 {
+				offset += len("{{")
+			}
+			vPos := offset
+			offset += len(v)
 			if len(v) == 0 {
 				continue
 			}
@@ -1901,12 +2465,12 @@ func parseBeard(txt string) (Statement, error) {
 				if len(sp) == 2 {
 					code := sp[0]
 					if len(code) != 0 {
-						node, err := compileJS(code)
+						exp, err := c.compileExpression(code, "{{}}", vPos)
 						if err != nil {
 							return nil, err
 						}
 						sg.Append(&mustacheStatement{
-							exp: &jsExpression{node: node, code: code},
+							exp: exp,
 						})
 					}
 					if len(sp[1]) != 0 {
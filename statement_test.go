@@ -54,7 +54,7 @@ func TestSimpleNodeVue(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, _, err := toStatement(vn)
+	c, _, err := (&compiler{}).toStatement(vn)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+// 测试$attrs与inheritAttrs
+func TestAttrs(t *testing.T) {
+	components := map[string]string{
+		// 声明了props, 其他属性会继承到root节点
+		"my-button": `<script props>{label: String, size: Number}</script>
+<button class="btn" :data-size="size">{{label}}</button>`,
+		// 没有声明props, 与之前的行为一致
+		"plain": `<span class="plain"></span>`,
+		// 将$attrs放在内部的input上
+		"my-input": `<script props>['label']</script>
+<script options>{inheritAttrs: false}</script>
+<label class="field">{{label}}<input class="input" v-bind="$attrs"></label>`,
+		"show-attrs": `<script props>['a']</script><p>{{a}} {{$attrs.b}} {{$props.b}} {{b}}</p>`,
+	}
+
+	cases := []struct {
+		Name string
+		Tpl  string
+		Want string
+	}{
+		{
+			Name: "fallthrough without declared props",
+			Tpl:  `<my-button label="ok" size="2" title="t" data-x="1" class="a" :style="{color: 'red'}"></my-button>`,
+			Want: `<button class="btn a" data-size="2" data-x="1" style="color: red;" title="t">ok</button>`,
+		},
+		{
+			Name: "undeclared component",
+			Tpl:  `<plain label="ok" title="t" class="a"></plain>`,
+			Want: `<span class="plain a"></span>`,
+		},
+		{
+			Name: "inheritAttrs false",
+			Tpl:  `<my-input label="name" class="a" style="color: red" placeholder="x" :maxlength="10"></my-input>`,
+			Want: `<label class="field">name<input class="input a" maxlength="10" placeholder="x" style="color: red;"></input></label>`,
+		},
+		{
+			// 没有声明的属性只在$attrs中
+			Name: "read $attrs",
+			Tpl:  `<show-attrs a="1" b="2"></show-attrs>`,
+			Want: `<p b="2">1 2 null null</p>`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New()
+			err := v.ComponentTxt("main", c.Tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, tpl := range components {
+				err = v.ComponentTxt(name, tpl)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			html, err := v.RenderComponent("main", &vpl.RenderParam{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != c.Want {
+				t.Fatalf("want: %s, get: %s", c.Want, html)
+			}
+		})
+	}
+}
+
+// RenderTpl的props也会继承到根节点
+func TestRenderTplAttrs(t *testing.T) {
+	props := vpl.NewProps()
+	props.Append("class", "c")
+	props.Append("id", "x")
+	html, err := vpl.New().RenderTpl(`<div class="a"></div>`, &vpl.RenderParam{Props: props})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html != `<div class="a c" id="x"></div>` {
+		t.Fatal(html)
+	}
+}
@@ -0,0 +1,268 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zbysir/vpl"
+)
+
+// 记录写入的key
+type mapStore struct {
+	mu   sync.Mutex
+	m    map[string][]byte
+	keys []string
+}
+
+func (s *mapStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.m[key]
+	return v, ok
+}
+
+func (s *mapStore) Set(key string, value []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = value
+	s.keys = append(s.keys, key)
+}
+
+func (s *mapStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+}
+
+func TestCacheComponent(t *testing.T) {
+	store := &mapStore{m: map[string][]byte{}}
+	v := vpl.New(vpl.WithCacheStore(store))
+	n := 0
+	v.Function("count", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		n++
+		return n
+	})
+	components := map[string]string{
+		"widget": `<style>.w{color:red}</style><div class="w">{{ name }}:{{ count() }}<parallel><i>{{ count() }}</i></parallel><vpl-head :key="name"><b>{{ name }}</b></vpl-head></div>`,
+		"page":   `<html><head><vpl-outlet></vpl-outlet></head><body><widget :name="name"></widget></body></html>`,
+	}
+	for name, tpl := range components {
+		err := v.ComponentTxt(name, tpl)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+	}
+	v.CacheComponent("widget", func(props *vpl.Props) string {
+		name, _ := props.Get("name")
+		if name == "nocache" {
+			return ""
+		}
+		return fmt.Sprint(name)
+	}, 0)
+
+	page := func(name string, id1, id2 int) string {
+		return fmt.Sprintf(`<html><head><b>%s</b></head><body><style>.w{color:red}</style><div class="w">%s:%d<i>%d</i></div></body></html>`, name, name, id1, id2)
+	}
+	cases := []struct {
+		Name       string
+		Invalidate string
+		Output     string
+	}{
+		{Name: "a", Output: page("a", 1, 2)},
+		{Name: "a", Output: page("a", 1, 2)},
+		{Name: "b", Output: page("b", 3, 4)},
+		{Name: "a", Invalidate: "a", Output: page("a", 5, 6)},
+		{Name: "nocache", Output: page("nocache", 7, 8)},
+		{Name: "nocache", Output: page("nocache", 9, 10)},
+	}
+
+	for i, c := range cases {
+		if c.Invalidate != "" {
+			v.InvalidateComponent("widget", c.Invalidate)
+		}
+		props := vpl.NewProps()
+		props.AppendMap(map[string]interface{}{"name": c.Name})
+		html, err := v.RenderComponent("page", &vpl.RenderParam{Props: props})
+		if err != nil {
+			t.Fatal(c.Name, err)
+		}
+		if html != c.Output {
+			t.Fatalf("%d %s\nwant: %s\nget:  %s", i, c.Name, c.Output, html)
+		}
+	}
+
+	if s := v.CacheStats("widget"); s != (vpl.CacheStats{Hits: 1, Misses: 3}) {
+		t.Fatalf("%+v", s)
+	}
+	if fmt.Sprint(store.keys) != "[widget:2:a widget:2:b widget:2:a]" {
+		t.Fatal(store.keys)
+	}
+
+	// 取消缓存
+	v.CacheComponent("widget", nil, 0)
+	_, err := v.RenderComponent("widget", &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := v.CacheStats("widget"); s != (vpl.CacheStats{}) {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestCacheComponentTTL(t *testing.T) {
+	v := vpl.New()
+	n := 0
+	v.Function("count", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		n++
+		return n
+	})
+	err := v.ComponentTxt("c", `<p>{{ count() }}</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.CacheComponent("c", func(props *vpl.Props) string { return "c" }, 50*time.Millisecond)
+
+	for _, want := range []string{"<p>1</p>", "<p>1</p>", "wait", "<p>2</p>"} {
+		if want == "wait" {
+			time.Sleep(80 * time.Millisecond)
+			continue
+		}
+		html, err := v.RenderComponent("c", &vpl.RenderParam{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if html != want {
+			t.Fatalf("want: %s, get: %s", want, html)
+		}
+	}
+}
+
+// 重新注册组件(包括其中调用的组件)之后不再使用之前缓存的结果, 动态组件也使用缓存
+func TestCacheComponentReplace(t *testing.T) {
+	v := vpl.New()
+	n := 0
+	v.Function("count", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		n++
+		return n
+	})
+	err := v.ComponentTxt("c", `<p>{{ count() }}<child></child></p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.ComponentTxt("main", `<div><c k="a"></c><component is="c" k="b"></component></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.ComponentTxt("child", ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.CacheComponent("c", func(props *vpl.Props) string {
+		k, _ := props.Get("k")
+		return fmt.Sprint(k)
+	}, 0)
+
+	for i, want := range []string{
+		`<div><p>1</p><p>2</p></div>`,
+		`<div><p>1</p><p>2</p></div>`,
+		"replace",
+		`<div><b>3</b><b>4</b></div>`,
+		`<div><b>3</b><b>4</b></div>`,
+		"replace child",
+		`<div><b>5<i></i></b><b>6<i></i></b></div>`,
+		`<div><b>5<i></i></b><b>6<i></i></b></div>`,
+	} {
+		switch want {
+		case "replace":
+			err = v.ReplaceTxt(map[string]string{"c": `<b>{{ count() }}<child></child></b>`})
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		case "replace child":
+			err = v.ReplaceTxt(map[string]string{"child": `<i></i>`})
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		html, err := v.RenderComponent("main", &vpl.RenderParam{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if html != want {
+			t.Fatalf("%d want: %s, get: %s", i, want, html)
+		}
+	}
+
+	// InvalidateComponent使用当前的版本
+	v.InvalidateComponent("c", "b")
+	html, err := v.RenderComponent("main", &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html != `<div><b>5<i></i></b><b>7<i></i></b></div>` {
+		t.Fatal(html)
+	}
+}
+
+// <parallel>渲染了备选内容时不缓存结果
+func TestCacheComponentFallback(t *testing.T) {
+	fail := true
+	v := vpl.New()
+	v.Function("load", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		if fail {
+			panic("boom")
+		}
+		return "data"
+	})
+	err := v.ComponentTxt("c", `<p><parallel>{{ load() }}<template #error>failed</template></parallel></p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.CacheComponent("c", func(props *vpl.Props) string { return "c" }, 0)
+
+	for i, c := range []struct {
+		Fail bool
+		Want string
+	}{
+		{Fail: true, Want: `<p>failed</p>`},
+		{Fail: false, Want: `<p>data</p>`},
+		{Fail: true, Want: `<p>data</p>`},
+	} {
+		fail = c.Fail
+		html, err := v.RenderComponent("c", &vpl.RenderParam{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if html != c.Want {
+			t.Fatalf("%d want: %s, get: %s", i, c.Want, html)
+		}
+	}
+	if s := v.CacheStats("c"); s != (vpl.CacheStats{Hits: 1, Misses: 2}) {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestCacheComponentKeyPanic(t *testing.T) {
+	v := vpl.New()
+	err := v.ComponentTxt("c", `<p></p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.ComponentTxt("main", "<div>\n  <c></c>\n</div>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.CacheComponent("c", func(props *vpl.Props) string { panic("boom") }, 0)
+
+	_, err = v.RenderComponent("main", &vpl.RenderParam{})
+	var re *vpl.RenderError
+	if !errors.As(err, &re) || !strings.Contains(err.Error(), `main:2:3: component main: component "c": cache key panic: boom`) {
+		t.Fatalf("want RenderError, get: %v", err)
+	}
+}
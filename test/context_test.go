@@ -0,0 +1,115 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+type ctxKey struct{}
+
+// 测试RenderParam.Ctx的取消
+func TestRenderCancel(t *testing.T) {
+	t.Run("canceled before render", func(t *testing.T) {
+		v := vpl.New()
+		err := v.ComponentTxt("main", `<div><p>{{a}}</p><p>{{b}}</p></div>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = v.RenderComponent("main", &vpl.RenderParam{Ctx: c})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("want context.Canceled, get: %v", err)
+		}
+	})
+
+	t.Run("canceled in v-for", func(t *testing.T) {
+		v := vpl.New()
+		err := v.ComponentTxt("main", `<ul><li v-for="i in list">{{ visit(i) }}</li></ul>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var count int
+		v.Function("visit", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+			count++
+			if count == 3 {
+				cancel()
+			}
+			return args[0]
+		})
+
+		props := vpl.NewProps()
+		props.Append("list", []interface{}{1, 2, 3, 4, 5, 6})
+		_, err = v.RenderComponent("main", &vpl.RenderParam{Ctx: c, Props: props})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("want context.Canceled, get: %v", err)
+		}
+		if count != 3 {
+			t.Fatalf("loop did not stop, count: %d", count)
+		}
+	})
+
+	t.Run("stop spawning parallel", func(t *testing.T) {
+		v := vpl.New()
+		err := v.ComponentTxt("main", `<div>
+	<span>{{ stop() }}</span>
+	<parallel v-for="i in list"><p>{{ work(i) }}</p></parallel>
+</div>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var count int32
+		v.Function("stop", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+			cancel()
+			return ""
+		})
+		v.Function("work", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+			atomic.AddInt32(&count, 1)
+			return args[0]
+		})
+
+		props := vpl.NewProps()
+		props.Append("list", []interface{}{1, 2, 3})
+		_, err = v.RenderComponent("main", &vpl.RenderParam{Ctx: c, Props: props})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("want context.Canceled, get: %v", err)
+		}
+		if n := atomic.LoadInt32(&count); n != 0 {
+			t.Fatalf("parallel should not run after cancel, count: %d", n)
+		}
+	})
+
+	t.Run("ctx in function and directive", func(t *testing.T) {
+		v := vpl.New()
+		err := v.ComponentTxt("main", `<div v-user="1">{{ user() }}</div>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.Function("user", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+			return ctx.Ctx.Value(ctxKey{})
+		})
+		v.Directive("user", func(ctx *vpl.RenderCtx, nodeData *vpl.NodeData, binding *vpl.DirectivesBinding) {
+			nodeData.Props.Append("data-user", ctx.Ctx.Value(ctxKey{}))
+		})
+
+		c := context.WithValue(context.Background(), ctxKey{}, "bysir")
+		html, err := v.RenderComponent("main", &vpl.RenderParam{Ctx: c})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if html != `<div data-user="bysir">bysir</div>` {
+			t.Fatal(html)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+// 测试html元素与组件的区分
+func TestElement(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Tpl     string
+		Options []vpl.Options
+		Want    string
+	}{
+		{
+			Name: "html5",
+			Tpl:  `<main><nav><a href="/">home</a></nav><section><article :id="n"><label>name</label><select><option>1</option></select></article></section></main>`,
+			Want: `<main><nav><a href="/">home</a></nav><section><article id="1"><label>name</label><select><option>1</option></select></article></section></main>`,
+		},
+		{
+			Name: "svg",
+			Tpl:  `<svg viewBox="0 0 10 10"><g><path :d="'M' + n" /><linearGradient id="g"><stop offset="0"/></linearGradient></g><text>{{n}}</text></svg>`,
+			Want: `<svg viewBox="0 0 10 10"><g><path d="M1"></path><linearGradient id="g"><stop offset="0"></stop></linearGradient></g><text>1</text></svg>`,
+		},
+		{
+			Name: "math",
+			Tpl:  `<math><mrow><mi>x</mi><mo>=</mo><mn>{{n}}</mn></mrow></math>`,
+			Want: `<math><mrow><mi>x</mi><mo>=</mo><mn>1</mn></mrow></math>`,
+		},
+		{
+			Name: "custom element",
+			Tpl:  `<div><my-element :data-id="n" class="a" v-if="n">{{n}}</my-element><my-static>x</my-static></div>`,
+			Want: `<div><my-element class="a" data-id="1">1</my-element><my-static>x</my-static></div>`,
+		},
+		{
+			Name: "registered custom element",
+			Tpl:  `<div><my-button>ok</my-button></div>`,
+			Want: `<div><button class="my-button">ok</button></div>`,
+		},
+		{
+			// 注册了同名组件的html元素渲染组件
+			Name: "registered element",
+			Tpl:  `<div><aside :id="n">x</aside><section>y</section></div>`,
+			Want: `<div><aside class="aside" id="1">x</aside><section>y</section></div>`,
+		},
+		{
+			Name:    "add element",
+			Tpl:     `<div><foo :id="n">x</foo></div>`,
+			Options: []vpl.Options{vpl.WithElements(map[string]bool{"foo": true})},
+			Want:    `<div><foo id="1">x</foo></div>`,
+		},
+		{
+			Name:    "override element",
+			Tpl:     `<div><header>x</header></div>`,
+			Options: []vpl.Options{vpl.WithElements(map[string]bool{"header": false})},
+			Want:    `<div><div class="header">x</div></div>`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New(c.Options...)
+			err := v.ComponentTxt("main", c.Tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 组件可以在使用它的组件之后注册
+			err = v.ComponentTxt("my-button", `<button class="my-button"><slot></slot></button>`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = v.ComponentTxt("header", `<div class="header"><slot></slot></div>`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 组件中与组件同名的<aside>作为标签渲染
+			err = v.ComponentTxt("aside", `<aside class="aside"><slot></slot></aside>`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			props := vpl.NewProps()
+			props.Append("n", 1)
+			html, err := v.RenderComponent("main", &vpl.RenderParam{Props: props})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != c.Want {
+				t.Fatalf("want: %s, get: %s", c.Want, html)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+// 测试表达式出错时的处理
+func TestRenderError(t *testing.T) {
+	cases := []struct {
+		Name      string
+		Tpl       string
+		Component string
+		Statement string
+		Code      string
+		Lenient   string
+	}{
+		{
+			Name:      "bad func",
+			Tpl:       `<div>{{ user.name() }}</div>`,
+			Component: "main",
+			Statement: "{{}}",
+			Code:      " user.name() ",
+			Lenient:   `<div></div>`,
+		},
+		{
+			Name:      "func panic",
+			Tpl:       `<div :title="boom()">ok</div>`,
+			Component: "main",
+			Statement: "v-bind:title",
+			Code:      "boom()",
+			Lenient:   `<div title>ok</div>`,
+		},
+		{
+			Name:      "unsupported expression",
+			Tpl:       `<div><span v-if="a = 1">a</span>b</div>`,
+			Component: "main",
+			Statement: "v-if",
+			Code:      "a = 1",
+			Lenient:   `<div>b</div>`,
+		},
+		{
+			Name:      "in child component",
+			Tpl:       `<div><child></child></div>`,
+			Component: "child",
+			Statement: "v-for",
+			Code:      "boom()",
+			Lenient:   `<div><ul></ul></div>`,
+		},
+		{
+			// slot中的表达式属于声明slot的组件
+			Name:      "in slot",
+			Tpl:       `<div><wrap><p>{{ boom() }}</p></wrap></div>`,
+			Component: "main",
+			Statement: "{{}}",
+			Code:      " boom() ",
+			Lenient:   `<div><div class="wrap"><p></p></div></div>`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			for _, mode := range []vpl.ErrorMode{vpl.ErrorModeAbort, vpl.ErrorModeLenient} {
+				v := vpl.New(vpl.WithErrorMode(mode))
+				err := v.ComponentTxt("main", c.Tpl)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = v.ComponentTxt("child", `<ul><li v-for="item in boom()">{{item}}</li></ul>`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = v.ComponentTxt("wrap", `<div class="wrap"><slot></slot></div>`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				v.Function("boom", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+					panic("boom")
+				})
+
+				props := vpl.NewProps()
+				props.Append("user", map[string]interface{}{"name": "bysir"})
+
+				html, err := v.RenderComponent("main", &vpl.RenderParam{
+					Ctx:   context.Background(),
+					Props: props,
+				})
+
+				if mode == vpl.ErrorModeLenient {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if html != c.Lenient {
+						t.Fatalf("want: %s, get: %s", c.Lenient, html)
+					}
+					continue
+				}
+
+				var re *vpl.RenderError
+				if !errors.As(err, &re) {
+					t.Fatalf("want RenderError, get: %v, html: %s", err, html)
+				}
+				if re.Component != c.Component || re.Statement != c.Statement || re.Code != c.Code {
+					t.Fatalf("bad RenderError: %+v", re)
+				}
+				t.Log(err)
+			}
+		})
+	}
+}
+
+// 测试编译错误与运行错误中的位置信息
+func TestErrorPosition(t *testing.T) {
+	cases := []struct {
+		Name string
+		Tpl  string
+		Pos  string
+	}{
+		{
+			Name: "mustache",
+			Tpl: `<div>
+  <p>{{ (x }}</p>
+</div>`,
+			Pos: "app.vue:2:12",
+		},
+		{
+			Name: "prop",
+			Tpl: `<div>
+	<p :id="a b">x</p>
+</div>`,
+			Pos: "app.vue:2:12",
+		},
+		{
+			Name: "v-if",
+			Tpl: `<div>
+	<p v-if=" 中文 + ">x</p>
+</div>`,
+			Pos: "app.vue:2:16",
+		},
+		{
+			Name: "v-else",
+			Tpl: `<div>
+	<p>x</p>
+	<p v-else>x</p>
+</div>`,
+			Pos: "app.vue:3:2",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New()
+			err := v.ComponentTxt("app.vue", c.Tpl)
+			if err == nil {
+				t.Fatal("want compile error")
+			}
+			var ce *vpl.CompileError
+			if !errors.As(err, &ce) {
+				t.Fatalf("want CompileError, get: %v", err)
+			}
+			if ce.Pos.String() != c.Pos {
+				t.Fatalf("want: %s, get: %s", c.Pos, ce.Pos)
+			}
+			if !strings.HasPrefix(err.Error(), c.Pos+": ") {
+				t.Fatalf("bad error message: %s", err)
+			}
+			t.Log(err)
+		})
+	}
+
+	t.Run("render", func(t *testing.T) {
+		v := vpl.New()
+		err := v.ComponentTxt("app.vue", `<div>
+	<p>{{ a }} {{ boom() }}</p>
+</div>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.Function("boom", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+			panic("boom")
+		})
+		_, err = v.RenderComponent("app.vue", &vpl.RenderParam{})
+
+		var re *vpl.RenderError
+		if !errors.As(err, &re) {
+			t.Fatalf("want RenderError, get: %v", err)
+		}
+		if re.Pos.String() != "app.vue:2:15" {
+			t.Fatalf("bad position: %s", re.Pos)
+		}
+		if !strings.Contains(re.Snippet, "2 | \t<p>{{ a }} {{ boom() }}</p>\n  | \t             ^") {
+			t.Fatalf("bad snippet: \n%s", re.Snippet)
+		}
+		t.Log(err)
+	})
+}
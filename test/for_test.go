@@ -0,0 +1,246 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zbysir/vpl"
+)
+
+func TestFor(t *testing.T) {
+	type item struct {
+		Name string
+	}
+	ch := func() chan string {
+		c := make(chan string, 3)
+		c <- "a"
+		c <- "b"
+		close(c)
+		return c
+	}
+
+	cases := []struct {
+		Name   string
+		Tpl    string
+		Data   interface{}
+		Output string
+	}{
+		{
+			Name:   "object",
+			Tpl:    `<p v-for="(value, key, index) in data">{{index}}.{{key}}={{value}}</p>`,
+			Data:   map[string]interface{}{"b": 2, "a": 1, "c": 3},
+			Output: `<p>0.a=1</p><p>1.b=2</p><p>2.c=3</p>`,
+		},
+		{
+			Name:   "object literal",
+			Tpl:    `<p v-for="(value, key) in {y: 1, x: 2}">{{key}}={{value}}</p>`,
+			Output: `<p>x=2</p><p>y=1</p>`,
+		},
+		{
+			Name:   "go map",
+			Tpl:    `<p v-for="(value, key) of data">{{key}}={{value}}</p>`,
+			Data:   map[int]string{10: "ten", 2: "two"},
+			Output: `<p>2=two</p><p>10=ten</p>`,
+		},
+		{
+			Name:   "range",
+			Tpl:    `<i v-for="n in 3">{{n}}</i>`,
+			Output: `<i>1</i><i>2</i><i>3</i>`,
+		},
+		{
+			Name:   "range of variable",
+			Tpl:    `<i v-for="(n, i) in data">{{i}}:{{n}}</i>`,
+			Data:   int64(2),
+			Output: `<i>0:1</i><i>1:2</i>`,
+		},
+		{
+			Name:   "typed slice",
+			Tpl:    `<i v-for="(item, index) of data">{{index}}:{{item.Name}}</i>`,
+			Data:   []*item{{Name: "a"}, {Name: "b"}},
+			Output: `<i>0:a</i><i>1:b</i>`,
+		},
+		{
+			Name:   "channel",
+			Tpl:    `<i v-for="s in data">{{s}}</i>`,
+			Data:   ch(),
+			Output: `<i>a</i><i>b</i>`,
+		},
+		{
+			Name:   "string",
+			Tpl:    `<i v-for="c in 'ab'">{{c}}</i>`,
+			Output: `<i>a</i><i>b</i>`,
+		},
+	}
+
+	v := vpl.New()
+	for _, c := range cases {
+		html, err := v.RenderTpl(c.Tpl, &vpl.RenderParam{Global: map[string]interface{}{"data": c.Data}})
+		if err != nil {
+			t.Fatal(c.Name, err)
+		}
+		if html != c.Output {
+			t.Fatalf("%s\nwant: %s\nget:  %s", c.Name, c.Output, html)
+		}
+	}
+
+	// 不能遍历的类型
+	_, err := v.RenderTpl(`<i v-for="n in 1.5">{{n}}</i>`, &vpl.RenderParam{})
+	if err == nil || !strings.Contains(err.Error(), "invalid range 1.5") {
+		t.Fatal(err)
+	}
+	_, err = v.RenderTpl(`<i v-for="n in data">{{n}}</i>`, &vpl.RenderParam{Global: map[string]interface{}{"data": true}})
+	if err == nil || !strings.Contains(err.Error(), "cannot range over bool") {
+		t.Fatal(err)
+	}
+
+	// 等待chan时取消渲染
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = v.RenderTpl(`<i v-for="n in data">{{n}}</i>`, &vpl.RenderParam{Ctx: ctx, Global: map[string]interface{}{"data": make(chan int)}})
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Fatal(err)
+	}
+}
+
+func TestForErrors(t *testing.T) {
+	cases := []struct {
+		Tpl string
+		Err string
+	}{
+		{
+			Tpl: `<p v-for="item">{{item}}</p>`,
+			Err: `c:1:11: invalid v-for expression "item", want "item in list"`,
+		},
+		{
+			Tpl: `<p v-for="item in ">{{item}}</p>`,
+			Err: `c:1:11: invalid v-for expression "item in "`,
+		},
+		{
+			Tpl: `<p v-for="(a, b, c, d) in list">{{a}}</p>`,
+			Err: `c:1:11: invalid v-for alias "a, b, c, d"`,
+		},
+		{
+			Tpl: `<p v-for="(a.b, c) in list">{{a}}</p>`,
+			Err: `c:1:11: invalid v-for alias "a.b, c"`,
+		},
+		{
+			Tpl: `<p v-for="item of (list">{{item}}</p>`,
+			Err: `c:1:24: Unexpected end of input`,
+		},
+	}
+
+	for _, c := range cases {
+		err := vpl.New().ComponentTxt("c", c.Tpl)
+		if err == nil || !strings.HasPrefix(err.Error(), c.Err) {
+			t.Fatalf("%s: want %s, get: %v", c.Tpl, c.Err, err)
+		}
+	}
+}
+
+func TestForElse(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Tpl    string
+		Data   interface{}
+		Output string
+	}{
+		{
+			Name:   "empty",
+			Tpl:    `<ul><li v-for="item in data">{{item}}</li><li v-else class="empty">no results</li></ul>`,
+			Data:   []string{},
+			Output: `<ul><li class="empty">no results</li></ul>`,
+		},
+		{
+			Name:   "nil",
+			Tpl:    `<ul><li v-for="item in data">{{item}}</li><!-- 空 --><template v-else>none</template></ul>`,
+			Output: `<ul>none<!-- 空 --></ul>`,
+		},
+		{
+			Name:   "not empty",
+			Tpl:    `<ul><li v-for="item in data">{{item}}</li><li v-else>no results</li></ul>`,
+			Data:   map[string]int{"a": 1},
+			Output: `<ul><li>1</li></ul>`,
+		},
+		{
+			// 同时有v-for与v-if时, v-else属于v-if
+			Name:   "v-if",
+			Tpl:    `<ul><li v-for="item in data" v-if="item > 1">{{item}}</li><li v-else>small</li></ul>`,
+			Data:   []int{1, 2},
+			Output: `<ul><li>small</li><li>2</li></ul>`,
+		},
+		{
+			Name:   "nested",
+			Tpl:    `<div v-for="l in data"><i v-for="i in l">{{i}}</i><b v-else>-</b></div><p v-else>empty</p>`,
+			Data:   [][]int{{1}, {}},
+			Output: `<div><i>1</i></div><div><b>-</b></div>`,
+		},
+	}
+
+	v := vpl.New()
+	for _, c := range cases {
+		html, err := v.RenderTpl(c.Tpl, &vpl.RenderParam{Global: map[string]interface{}{"data": c.Data}})
+		if err != nil {
+			t.Fatal(c.Name, err)
+		}
+		if html != c.Output {
+			t.Fatalf("%s\nwant: %s\nget:  %s", c.Name, c.Output, html)
+		}
+	}
+
+	// v-else需要紧跟在v-for之后
+	err := v.ComponentTxt("c", `<ul><li v-for="item in data">{{item}}</li><li></li><li v-else></li></ul>`)
+	if err == nil || !strings.HasPrefix(err.Error(), "c:1:52: v-else must below v-if or v-for") {
+		t.Fatal(err)
+	}
+}
+
+func TestForLoop(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Tpl    string
+		Data   interface{}
+		Output string
+	}{
+		{
+			Name:   "separator",
+			Tpl:    `<p><template v-for="item in data">{{item}}<template v-if="!$loop.last">|</template></template></p>`,
+			Data:   []string{"a", "b", "c"},
+			Output: `<p>a|b|c</p>`,
+		},
+		{
+			Name:   "meta",
+			Tpl:    `<i v-for="(v, k) in data" :class="{odd: $loop.odd, even: $loop.even, first: $loop.first}">{{$loop.index1}}/{{$loop.length}}:{{k}}</i>`,
+			Data:   map[string]int{"x": 1, "y": 2},
+			Output: `<i class="first odd">1/2:x</i><i class="even">2/2:y</i>`,
+		},
+		{
+			Name:   "parent",
+			Tpl:    `<div v-for="row in data"><i v-for="n in row">{{$loop.parent.index}}.{{$loop.index}}</i></div>`,
+			Data:   []int{1, 2},
+			Output: `<div><i>0.0</i></div><div><i>1.0</i><i>1.1</i></div>`,
+		},
+		{
+			// 在slot中使用
+			Name:   "slot",
+			Tpl:    `<wrap v-for="n in 2">{{$loop.first ? 'first' : n}}</wrap>`,
+			Output: `<b>first</b><b>2</b>`,
+		},
+	}
+
+	v := vpl.New()
+	err := v.ComponentTxt("wrap", `<b><slot></slot></b>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		html, err := v.RenderTpl(c.Tpl, &vpl.RenderParam{Global: map[string]interface{}{"data": c.Data}})
+		if err != nil {
+			t.Fatal(c.Name, err)
+		}
+		if html != c.Output {
+			t.Fatalf("%s\nwant: %s\nget:  %s", c.Name, c.Output, html)
+		}
+	}
+}
@@ -120,3 +120,127 @@ func TestFunc(t *testing.T) {
 
 	}
 }
+
+type funcUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+type funcCtxKey struct{}
+
+// 测试Vpl.Func注册的go方法
+func TestGoFunc(t *testing.T) {
+	cases := []struct {
+		Name string
+		Tpl  string
+		Want string
+		Err  string
+	}{
+		{
+			Name: "number",
+			Tpl:  `{{ add(1, 2) }}`,
+			Want: `3`,
+		},
+		{
+			Name: "string to number",
+			Tpl:  `{{ add('1', 2.0) }}`,
+			Want: `3`,
+		},
+		{
+			Name: "variadic",
+			Tpl:  `{{ join('-') }}|{{ join('-', 'a', 'b', 1) }}`,
+			Want: `|a-b-1`,
+		},
+		{
+			Name: "map to struct",
+			Tpl:  `{{ greet({name: 'bysir', age: 18}) }}`,
+			Want: `bysir(18)`,
+		},
+		{
+			Name: "slice",
+			Tpl:  `{{ sum([1, 2, 3]) }}`,
+			Want: `6`,
+		},
+		{
+			Name: "render ctx",
+			Tpl:  `{{ scopeGet('name') }}`,
+			Want: `vpl`,
+		},
+		{
+			Name: "context",
+			Tpl:  `{{ fromCtx() }}`,
+			Want: `bysir`,
+		},
+		{
+			Name: "func field",
+			Tpl:  `{{ helper.Double(2) }}`,
+			Want: `4`,
+		},
+		{
+			Name: "returned error",
+			Tpl:  `{{ div(1, 0) }}`,
+			Err:  `call func div: divide by zero`,
+		},
+		{
+			Name: "conversion error",
+			Tpl:  `{{ add(1.5, 1) }}`,
+			Err:  `call func add: argument 0: cannot convert 1.5 to int`,
+		},
+		{
+			Name: "bad number of arguments",
+			Tpl:  `{{ add(1) }}`,
+			Err:  `call func add: want 2 arguments, got 1`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New()
+			err := v.ComponentTxt("main", c.Tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.Func("add", func(a, b int) int { return a + b })
+			v.Func("join", func(sep string, s ...string) string { return strings.Join(s, sep) })
+			v.Func("greet", func(u funcUser) string { return fmt.Sprintf("%s(%d)", u.Name, u.Age) })
+			v.Func("sum", func(s []float64) (r float64) {
+				for _, i := range s {
+					r += i
+				}
+				return
+			})
+			v.Func("scopeGet", func(ctx *vpl.RenderCtx, key string) interface{} { return ctx.Scope.Get(key) })
+			v.Func("fromCtx", func(ctx context.Context) interface{} { return ctx.Value(funcCtxKey{}) })
+			v.Func("div", func(a, b float64) (float64, error) {
+				if b == 0 {
+					return 0, errors.New("divide by zero")
+				}
+				return a / b, nil
+			})
+
+			props := vpl.NewProps()
+			props.Append("name", "vpl")
+			props.Append("helper", struct{ Double func(int) int }{Double: func(i int) int { return i * 2 }})
+			html, err := v.RenderComponent("main", &vpl.RenderParam{
+				Ctx:   context.WithValue(context.Background(), funcCtxKey{}, "bysir"),
+				Props: props,
+			})
+			if c.Err != "" {
+				var re *vpl.RenderError
+				if !errors.As(err, &re) {
+					t.Fatalf("want RenderError, get: %v, html: %s", err, html)
+				}
+				if re.Err.Error() != c.Err {
+					t.Fatalf("want: %s, get: %s", c.Err, re.Err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != c.Want {
+				t.Fatalf("want: %s, get: %s", c.Want, html)
+			}
+		})
+	}
+}
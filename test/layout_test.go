@@ -0,0 +1,115 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+func TestExtends(t *testing.T) {
+	v := vpl.New(vpl.WithStrict(true))
+	components := map[string]string{
+		"layout": `<html>
+<head><block name="head"><title>Site</title></block></head>
+<body>
+  <h1><block name="title">Site</block></h1>
+  <block name="content"><p>empty</p></block>
+  <footer><block name="footer">&copy; {{ year }}</block></footer>
+</body>
+</html>`,
+		"docs": `<extends layout="layout">
+  <!-- 文档页面 -->
+  <block name="title">Docs/<super></super></block>
+  <block name="content"><nav>menu</nav><main><block name="main">no content</block></main></block>
+</extends>`,
+		"page": `<extends layout="docs">
+  <block name="title">{{ name }}/<super></super></block>
+  <block name="head"><title>{{ name }}</title><super></super></block>
+  <block name="main"><p>{{ name }}</p></block>
+</extends>`,
+	}
+	for name, tpl := range components {
+		err := v.ComponentTxt(name, tpl)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+	}
+	v.Global("year", 2024)
+
+	cases := []struct {
+		Name   string
+		Output string
+	}{
+		{
+			Name:   "layout",
+			Output: `<html><head><title>Site</title></head><body><h1>Site</h1><p>empty</p><footer>&copy; 2024</footer></body></html>`,
+		},
+		{
+			Name:   "docs",
+			Output: `<html><head><title>Site</title></head><body><h1>Docs/Site</h1><nav>menu</nav><main>no content</main><footer>&copy; 2024</footer></body></html>`,
+		},
+		{
+			Name:   "page",
+			Output: `<html><head><title>Intro</title><title>Site</title></head><body><h1>Intro/Docs/Site</h1><nav>menu</nav><main><p>Intro</p></main><footer>&copy; 2024</footer></body></html>`,
+		},
+	}
+
+	for _, c := range cases {
+		props := vpl.NewProps()
+		props.AppendMap(map[string]interface{}{"name": "Intro"})
+		html, err := v.RenderComponent(c.Name, &vpl.RenderParam{Props: props})
+		if err != nil {
+			t.Fatal(c.Name, err)
+		}
+		if html != c.Output {
+			t.Fatalf("%s\nwant: %s\nget:  %s", c.Name, c.Output, html)
+		}
+	}
+}
+
+func TestExtendsErrors(t *testing.T) {
+	cases := []struct {
+		Name string
+		Tpl  string
+		Err  string
+	}{
+		{
+			Name: "outside",
+			Tpl:  `<extends layout="base"></extends><p></p>`,
+			Err:  `c:1:34: unexpected <p>, a component that extends a layout can only contain <extends>`,
+		},
+		{
+			Name: "layout",
+			Tpl:  `<extends></extends>`,
+			Err:  `c:1:1: extends: missing 'layout' attribute`,
+		},
+		{
+			Name: "block",
+			Tpl:  `<extends layout="base"><div></div></extends>`,
+			Err:  `c:1:24: unexpected <div> in extends, want <block>`,
+		},
+		{
+			Name: "duplicate",
+			Tpl:  `<extends layout="base"><block name="a"></block><block name="a"></block></extends>`,
+			Err:  `c:1:48: block "a" is already defined`,
+		},
+	}
+
+	for _, c := range cases {
+		err := vpl.New().ComponentTxt("c", c.Tpl)
+		if err == nil || !strings.HasPrefix(err.Error(), c.Err) {
+			t.Fatalf("%s: want %s, get: %v", c.Name, c.Err, err)
+		}
+	}
+
+	v := vpl.New()
+	err := v.ComponentTxt("c", `<div><super></super></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.RenderComponent("c", &vpl.RenderParam{})
+	if err == nil || !strings.Contains(err.Error(), "super: used outside of an overriding <block>") {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"embed"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/zbysir/vpl"
+)
+
+//go:embed loadfs
+var loadFS embed.FS
+
+// 测试从fs.FS中加载组件
+func TestLoadFS(t *testing.T) {
+	v := vpl.New()
+	err := v.LoadFS(loadFS, "loadfs", &vpl.LoadOptions{Name: vpl.NameByNamespace})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, err := v.RenderComponent("Page", &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<div class="page"><label>name<input></label><button>ok</button></div>`
+	if html != want {
+		t.Fatalf("want: %s, get: %s", want, html)
+	}
+}
+
+func TestLoadFSName(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ui/form/TextInput.vue":   {Data: []byte(`<input>`)},
+		"ui/form/date_picker.vpl": {Data: []byte(`<input>`)},
+		"ui/card.vue":             {Data: []byte(`<div></div>`)},
+		"ui/card.md":              {Data: []byte(`# card`)},
+		"ui/.cache/x.vue":         {Data: []byte(`<p>{{ (x }}</p>`)},
+	}
+
+	cases := []struct {
+		Name     string
+		Strategy vpl.NameStrategy
+		Want     []string
+	}{
+		{
+			Name: "base",
+			Want: []string{"card", "date_picker", "TextInput"},
+		},
+		{
+			Name:     "kebab path",
+			Strategy: vpl.NameByKebabPath,
+			Want:     []string{"card", "form-date-picker", "form-text-input"},
+		},
+		{
+			Name:     "namespace",
+			Strategy: vpl.NameByNamespace,
+			Want:     []string{"Card", "Form.DatePicker", "Form.TextInput"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New(vpl.WithStrict(true))
+			err := v.LoadFS(fsys, "ui", &vpl.LoadOptions{Name: c.Strategy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range c.Want {
+				_, err := v.RenderComponent(name, &vpl.RenderParam{})
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFSError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/bad.vue":    {Data: []byte("<div>\n{{ (x }}</div>")},
+		"a/good.vue":   {Data: []byte(`<p></p>`)},
+		"b/good.vue":   {Data: []byte(`<p></p>`)},
+		"c/worse.vue":  {Data: []byte(`<p v-if="a +"></p>`)},
+		"d/broken.vpl": {Data: []byte(`<script props>{a: 'date'}</script><p></p>`)},
+	}
+
+	v := vpl.New(vpl.WithStrict(true))
+	err := v.LoadFS(fsys, ".", nil)
+	var errs vpl.ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("want ErrorList, get: %v", err)
+	}
+	want := `a/bad.vue:2:7: Unexpected end of input
+2 | {{ (x }}</div>
+  |       ^
+b/good.vue: component "good" is already defined in a/good.vue
+c/worse.vue:1:13: Unexpected token )
+1 | <p v-if="a +"></p>
+  |             ^
+d/broken.vpl:1:15: prop "a": unknown type "date"
+1 | <script props>{a: 'date'}</script><p></p>
+  |               ^`
+	if err.Error() != want {
+		t.Fatalf("want:\n%s\nget:\n%s", want, err)
+	}
+
+	// 出错时不会注册任何组件
+	_, err = v.RenderComponent("good", &vpl.RenderParam{})
+	if !errors.Is(err, vpl.ErrComponentNotFound) {
+		t.Fatalf("want ErrComponentNotFound, get: %v", err)
+	}
+}
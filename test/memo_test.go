@@ -0,0 +1,268 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+func TestMemo(t *testing.T) {
+	n := 0
+	v := vpl.New()
+	v.Function("count", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		n++
+		return n
+	})
+	err := v.ComponentTxt("nav", `<nav v-memo="[locale, role]">{{ count() }}:{{ locale }}/{{ role }}</nav><p v-once>{{ count() }}</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.ComponentTxt("list", `<i v-for="item in list" v-memo="[item]">{{ item }}{{ count() }}</i>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// v-once在v-for中按每一次循环的下标缓存
+	err = v.ComponentTxt("once", `<ul><li v-for="x in list"><b v-once>{{ x }}</b><i v-for="y in [x, 0]"><u v-once>{{ y }}</u></i></li></ul>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name      string
+		Component string
+		Global    map[string]interface{}
+		Output    string
+	}{
+		{
+			Name:      "miss",
+			Component: "nav",
+			Global:    map[string]interface{}{"locale": "en", "role": "admin"},
+			Output:    `<nav>1:en/admin</nav><p>2</p>`,
+		},
+		{
+			Name:      "hit",
+			Component: "nav",
+			Global:    map[string]interface{}{"locale": "en", "role": "admin"},
+			Output:    `<nav>1:en/admin</nav><p>2</p>`,
+		},
+		{
+			Name:      "changed",
+			Component: "nav",
+			Global:    map[string]interface{}{"locale": "zh", "role": "admin"},
+			Output:    `<nav>3:zh/admin</nav><p>2</p>`,
+		},
+		{
+			Name:      "hit again",
+			Component: "nav",
+			Global:    map[string]interface{}{"locale": "en", "role": "admin"},
+			Output:    `<nav>1:en/admin</nav><p>2</p>`,
+		},
+		{
+			// v-for中每次循环分别缓存
+			Name:      "v-for",
+			Component: "list",
+			Global:    map[string]interface{}{"list": []string{"a", "b"}},
+			Output:    `<i>a4</i><i>b5</i>`,
+		},
+		{
+			Name:      "v-for hit",
+			Component: "list",
+			Global:    map[string]interface{}{"list": []string{"b", "c", "a"}},
+			Output:    `<i>b5</i><i>c6</i><i>a4</i>`,
+		},
+		{
+			Name:      "v-once in v-for",
+			Component: "once",
+			Global:    map[string]interface{}{"list": []int{1, 2}},
+			Output:    `<ul><li><b>1</b><i><u>1</u></i><i><u>0</u></i></li><li><b>2</b><i><u>2</u></i><i><u>0</u></i></li></ul>`,
+		},
+		{
+			Name:      "v-once in v-for again",
+			Component: "once",
+			Global:    map[string]interface{}{"list": []int{3, 4, 5}},
+			Output:    `<ul><li><b>1</b><i><u>1</u></i><i><u>0</u></i></li><li><b>2</b><i><u>2</u></i><i><u>0</u></i></li><li><b>5</b><i><u>5</u></i><i><u>0</u></i></li></ul>`,
+		},
+	}
+
+	for _, c := range cases {
+		html, err := v.RenderComponent(c.Component, &vpl.RenderParam{Global: c.Global})
+		if err != nil {
+			t.Fatal(c.Name, err)
+		}
+		if html != c.Output {
+			t.Fatalf("%s\nwant: %s\nget:  %s", c.Name, c.Output, html)
+		}
+	}
+}
+
+func TestMemoSize(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Size   int
+		Output string
+	}{
+		{Name: "default", Size: 0, Output: `1,2,1,`},
+		{Name: "evicted", Size: 1, Output: `1,2,3,`},
+		{Name: "disabled", Size: -1, Output: `1,2,3,`},
+	}
+
+	for _, c := range cases {
+		options := []vpl.Options{}
+		if c.Size != 0 {
+			options = append(options, vpl.WithMemoSize(c.Size))
+		}
+		v := vpl.New(options...)
+		n := 0
+		v.Function("count", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+			n++
+			return n
+		})
+		err := v.ComponentTxt("c", `<template v-memo="[key]">{{ count() }},</template>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var b strings.Builder
+		for _, key := range []string{"a", "b", "a"} {
+			html, err := v.RenderComponent("c", &vpl.RenderParam{Global: map[string]interface{}{"key": key}})
+			if err != nil {
+				t.Fatal(c.Name, err)
+			}
+			b.WriteString(html)
+		}
+		if b.String() != c.Output {
+			t.Fatalf("%s\nwant: %s\nget:  %s", c.Name, c.Output, b.String())
+		}
+	}
+}
+
+// 缓存中的组件样式与推送到输出口的内容在命中缓存时也需要输出
+func TestMemoSideEffects(t *testing.T) {
+	v := vpl.New(vpl.WithParallelLimit(1))
+	components := map[string]string{
+		"card": `<style>.card{color:red}</style><div class="card"><vpl-head key="card"><meta name="card"></vpl-head></div>`,
+		"page": `<html><head><vpl-styles></vpl-styles><vpl-outlet></vpl-outlet></head><body><div v-memo="[1]"><card></card></div></body></html>`,
+		// 没有<vpl-styles>时样式在缓存的结果中, 不会重复输出
+		"inline": `<div v-once><card></card></div><card></card>`,
+		// 缓存中的parallel
+		"async": `<parallel><div v-memo="[1]"><parallel><card></card></parallel></div></parallel>`,
+		// 嵌套的v-memo, 外层的结果包含内层的副作用
+		"nested": `<html><head><vpl-styles></vpl-styles><vpl-outlet></vpl-outlet></head><body><div v-memo="[1]"><p v-memo="[a]"><card></card><vpl-head key="k"><meta name="k"></vpl-head></p></div></body></html>`,
+	}
+	for name, tpl := range components {
+		err := v.ComponentTxt(name, tpl)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+	}
+
+	cases := []struct {
+		Name   string
+		Output string
+	}{
+		{
+			Name:   "page",
+			Output: `<html><head><style>.card{color:red}</style><meta name="card"></head><body><div><div class="card"></div></div></body></html>`,
+		},
+		{
+			Name:   "inline",
+			Output: `<div><style>.card{color:red}</style><div class="card"></div></div><div class="card"></div>`,
+		},
+		{
+			Name:   "async",
+			Output: `<div><style>.card{color:red}</style><div class="card"></div></div>`,
+		},
+		{
+			Name:   "nested",
+			Output: `<html><head><style>.card{color:red}</style><meta name="card"><meta name="k"></head><body><div><p><div class="card"></div></p></div></body></html>`,
+		},
+	}
+
+	for _, c := range cases {
+		for i := 0; i < 2; i++ {
+			html, err := v.RenderComponent(c.Name, &vpl.RenderParam{})
+			if err != nil {
+				t.Fatal(c.Name, err)
+			}
+			if html != c.Output {
+				t.Fatalf("%s(%d)\nwant: %s\nget:  %s", c.Name, i, c.Output, html)
+			}
+		}
+	}
+}
+
+func TestMemoErrors(t *testing.T) {
+	cases := []struct {
+		Tpl string
+		Err string
+	}{
+		{
+			Tpl: `<div v-memo="">a</div>`,
+			Err: `c:1:14: v-memo: missing dependencies`,
+		},
+		{
+			Tpl: `<div v-memo="[a]" v-once>a</div>`,
+			Err: `c:1:25: v-memo and v-once can not be used together`,
+		},
+		{
+			Tpl: `<div v-memo="[a">a</div>`,
+			Err: `c:1:`,
+		},
+		{
+			Tpl: `<li v-for="x in list" v-once>{{ x }}</li>`,
+			Err: `c:1:29: v-once can not be used with v-for on the same element`,
+		},
+	}
+	for _, c := range cases {
+		err := vpl.New().ComponentTxt("c", c.Tpl)
+		if err == nil || !strings.HasPrefix(err.Error(), c.Err) {
+			t.Fatalf("%s: want %s, get: %v", c.Tpl, c.Err, err)
+		}
+	}
+
+	v := vpl.New()
+	err := v.ComponentTxt("c", `<html><head v-once><vpl-styles></vpl-styles></head></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.RenderComponent("c", &vpl.RenderParam{})
+	if err == nil || !strings.Contains(err.Error(), "<vpl-styles> can not be used in v-memo, v-once or a cached component") {
+		t.Fatal(err)
+	}
+}
+
+// <parallel>渲染了备选内容时不缓存结果
+func TestMemoFallback(t *testing.T) {
+	fail := true
+	v := vpl.New()
+	v.Function("load", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		if fail {
+			panic("boom")
+		}
+		return "data"
+	})
+	err := v.ComponentTxt("c", `<div v-once><p v-memo="[1]"><parallel>{{ load() }}<template #error>failed</template></parallel></p></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, c := range []struct {
+		Fail bool
+		Want string
+	}{
+		{Fail: true, Want: `<div><p>failed</p></div>`},
+		{Fail: false, Want: `<div><p>data</p></div>`},
+		{Fail: true, Want: `<div><p>data</p></div>`},
+	} {
+		fail = c.Fail
+		html, err := v.RenderComponent("c", &vpl.RenderParam{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if html != c.Want {
+			t.Fatalf("%d want: %s, get: %s", i, c.Want, html)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+func TestOutlet(t *testing.T) {
+	v := vpl.New()
+	err := v.ComponentTxt("layout", `<html><head><title>t</title><vpl-outlet></vpl-outlet></head><body><slot></slot><vpl-outlet name="scripts"></vpl-outlet></body></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.ComponentTxt("chart", `<div class="chart">
+  <vpl-head key="chart"><link rel="stylesheet" href="/chart.css"></vpl-head>
+  <teleport to="scripts" key="chart"><script src="/chart.js"></script></teleport>
+  <teleport to="scripts"><script>draw({{ n }})</script></teleport>
+  {{ n }}
+</div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name   string
+		Tpl    string
+		Output string
+	}{
+		{
+			Name: "outlet",
+			Tpl:  `<layout><chart :n="1"></chart><chart :n="2"></chart></layout>`,
+			Output: `<html><head><title>t</title><link rel="stylesheet" href="/chart.css"></head>` +
+				`<body><div class="chart">1</div><div class="chart">2</div>` +
+				`<script src="/chart.js"></script><script>draw(1)</script><script>draw(2)</script></body></html>`,
+		},
+		{
+			Name: "parallel",
+			Tpl:  `<layout><parallel><vpl-head><meta name="a"></vpl-head></parallel></layout>`,
+			Output: `<html><head><title>t</title><meta name="a"></head>` +
+				`<body></body></html>`,
+		},
+		{
+			// 没有输出口时内容被丢弃
+			Name:   "no outlet",
+			Tpl:    `<div><chart :n="1"></chart></div>`,
+			Output: `<div><div class="chart">1</div></div>`,
+		},
+	}
+
+	for _, c := range cases {
+		html, err := v.RenderTpl(c.Tpl, &vpl.RenderParam{})
+		if err != nil {
+			t.Fatal(c.Name, err)
+		}
+		if html != c.Output {
+			t.Fatalf("%s\nwant: %s\nget:  %s", c.Name, c.Output, html)
+		}
+	}
+
+	err = v.ComponentTxt("page", `<layout><chart :n="1"></chart></layout>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = v.RenderComponentTo(&buf, "page", &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<html><head><title>t</title><link rel="stylesheet" href="/chart.css"></head>` +
+		`<body><div class="chart">1</div><script src="/chart.js"></script><script>draw(1)</script></body></html>`
+	if buf.String() != want {
+		t.Fatal(buf.String())
+	}
+
+	// go中实现的组件
+	err = v.Component("analytics", vpl.FuncStatement(func(ctx *vpl.StatementCtx, o *vpl.StatementOptions) error {
+		s := vpl.NewChanSpan()
+		s.Done(`<script src="/a.js"></script>`, nil)
+		ctx.PushOutlet("head", "analytics", s)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, err := v.RenderTpl(`<layout><analytics></analytics><analytics></analytics></layout>`, &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html != `<html><head><title>t</title><script src="/a.js"></script></head><body></body></html>` {
+		t.Fatal(html)
+	}
+}
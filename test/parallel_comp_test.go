@@ -2,10 +2,13 @@ package test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/zbysir/vpl"
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -140,3 +143,213 @@ func interfaceToFloat(s interface{}) (d float64) {
 		return 0
 	}
 }
+
+// 测试parallel中的错误
+func TestParallelError(t *testing.T) {
+	cases := []struct {
+		Name string
+		Tpl  string
+		Want string // 为空时表示需要返回错误
+	}{
+		{
+			Name: "propagate",
+			Tpl:  `<div><parallel><p>{{ boom() }}</p></parallel><span>ok</span></div>`,
+		},
+		{
+			Name: "nested",
+			Tpl:  `<div><parallel><parallel><p>{{ boom() }}</p></parallel></parallel></div>`,
+		},
+		{
+			Name: "fallback",
+			Tpl:  `<div><parallel><p>{{ boom() }}</p><template #error="e"><p class="err">{{e.message}}</p></template></parallel><span>ok</span></div>`,
+			Want: `<div><p class="err">func panic: boom</p><span>ok</span></div>`,
+		},
+		{
+			Name: "fallback in nested",
+			Tpl:  `<div><parallel><parallel><p>{{ boom() }}</p></parallel><template #error><p>failed</p></template></parallel></div>`,
+			Want: `<div><p>failed</p></div>`,
+		},
+		{
+			Name: "no error",
+			Tpl:  `<div><parallel><p>{{ 1 + 1 }}</p><template #error><p>failed</p></template></parallel></div>`,
+			Want: `<div><p>2</p></div>`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New()
+			err := v.ComponentTxt("main", c.Tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.Function("boom", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+				panic("boom")
+			})
+
+			html, err := v.RenderComponent("main", &vpl.RenderParam{Ctx: context.Background()})
+			if c.Want == "" {
+				var re *vpl.RenderError
+				if !errors.As(err, &re) {
+					t.Fatalf("want RenderError, get: %v, html: %s", err, html)
+				}
+				t.Log(err)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != c.Want {
+				t.Fatalf("want: %s, get: %s", c.Want, html)
+			}
+		})
+	}
+}
+
+// 测试parallel的并发限制
+func TestParallelLimit(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Option   int
+		Param    int
+		MaxLimit int32
+	}{
+		{Name: "option", Option: 2, MaxLimit: 2},
+		{Name: "param override", Option: 2, Param: 1, MaxLimit: 1},
+		{Name: "unlimited", Option: 2, Param: -1, MaxLimit: 10},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New(vpl.WithParallelLimit(c.Option))
+			// 嵌套的parallel不应该死锁
+			err := v.ComponentTxt("main", `<div><parallel v-for="i in list"><p>{{ work(i) }}</p><parallel><span>{{ i }}</span></parallel></parallel></div>`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var running, max int32
+			v.Function("work", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return args[0]
+			})
+
+			props := vpl.NewProps()
+			props.Append("list", []interface{}{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+			html, err := v.RenderComponent("main", &vpl.RenderParam{
+				Ctx:           context.Background(),
+				Props:         props,
+				ParallelLimit: c.Param,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(html, `<div><p>0</p><span>0</span><p>1</p><span>1</span>`) {
+				t.Fatal(html)
+			}
+			if m := atomic.LoadInt32(&max); m > c.MaxLimit || (c.MaxLimit == 10 && m < 2) {
+				t.Fatalf("max running: %d, limit: %d", m, c.MaxLimit)
+			}
+		})
+	}
+}
+
+// 测试parallel的timeout
+func TestParallelTimeout(t *testing.T) {
+	cases := []struct {
+		Name string
+		Tpl  string
+		Want string // 为空时表示需要返回ErrParallelTimeout
+	}{
+		{
+			Name: "fallback",
+			Tpl:  `<div><parallel timeout="20ms"><p>{{ wait() }}</p><template #error="e"><p>{{e.message}}</p></template></parallel></div>`,
+			Want: `<div><p>parallel timeout after 20ms</p></div>`,
+		},
+		{
+			Name: "number",
+			Tpl:  `<div><parallel :timeout="20"><p>{{ wait() }}</p><template #error><p>slow</p></template></parallel></div>`,
+			Want: `<div><p>slow</p></div>`,
+		},
+		{
+			Name: "in time",
+			Tpl:  `<div><parallel timeout="1s"><p>{{ 1 }}</p><template #error><p>slow</p></template></parallel></div>`,
+			Want: `<div><p>1</p></div>`,
+		},
+		{
+			Name: "no fallback",
+			Tpl:  `<div><parallel timeout="20ms"><p>{{ wait() }}</p></parallel></div>`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New()
+			err := v.ComponentTxt("main", c.Tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			canceled := make(chan struct{})
+			v.Function("wait", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+				select {
+				case <-ctx.Ctx.Done():
+					close(canceled)
+				case <-time.After(time.Second):
+				}
+				return "done"
+			})
+
+			html, err := v.RenderComponent("main", &vpl.RenderParam{Ctx: context.Background()})
+			if c.Want == "" {
+				if !errors.Is(err, vpl.ErrParallelTimeout) {
+					t.Fatalf("want ErrParallelTimeout, get: %v, html: %s", err, html)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if html != c.Want {
+					t.Fatalf("want: %s, get: %s", c.Want, html)
+				}
+			}
+
+			if strings.Contains(c.Tpl, "wait()") {
+				select {
+				case <-canceled:
+				case <-time.After(time.Second):
+					t.Fatal("context of the abandoned goroutine is not canceled")
+				}
+			}
+		})
+	}
+}
+
+// 排队等待执行名额的时间不算在timeout中
+func TestParallelTimeoutQueued(t *testing.T) {
+	v := vpl.New(vpl.WithParallelLimit(1))
+	err := v.ComponentTxt("main", `<div><parallel v-for="i in 3" timeout="150ms"><i>{{ sleep(i) }}</i><template #error>T</template></parallel></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Function("sleep", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		time.Sleep(100 * time.Millisecond)
+		return args[0]
+	})
+
+	html, err := v.RenderComponent("main", &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<div><i>1</i><i>2</i><i>3</i></div>`; html != want {
+		t.Fatalf("want: %s, get: %s", want, html)
+	}
+}
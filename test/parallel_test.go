@@ -65,11 +65,12 @@ func TestGoParallel(t *testing.T) {
 				Props:  props,
 			})
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 
 			if ht != "<html><head><title>test</title></head><body><ul><li>ID=0, Message=message 0</li><li>ID=2, Message=message 2</li><li>ID=4, Message=message 4</li><li>ID=6, Message=message 6</li><li>ID=8, Message=message 8</li></ul></body></html>" {
-				t.Fatal(ht)
+				t.Error(ht)
 			}
 
 			//t.Logf("%v %s", rows[0].ID, ht)
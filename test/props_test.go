@@ -0,0 +1,206 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+// 测试组件声明props
+func TestPropsDeclare(t *testing.T) {
+	card := `
+<script props>
+{
+  title: {type: String, required: true},
+  count: {type: 'number', default: 1},
+  disabled: Boolean,
+  tags: {type: Array, default: ['a']},
+}
+</script>
+<div class="card">{{title}} {{count + 1}} {{disabled ? 'off' : 'on'}} <span v-for="t in tags">{{t}}</span></div>
+`
+
+	cases := []struct {
+		Name string
+		Tpl  string
+		Want string
+		Err  string
+	}{
+		{
+			Name: "default",
+			Tpl:  `<card title="hi"></card>`,
+			Want: `<div class="card">hi 2 on<span>a</span></div>`,
+		},
+		{
+			Name: "coerce string attribute",
+			Tpl:  `<card title="hi" count="10" disabled></card>`,
+			Want: `<div class="card">hi 11 off<span>a</span></div>`,
+		},
+		{
+			Name: "boolean attribute",
+			Tpl:  `<card title="hi" disabled="disabled"></card>`,
+			Want: `<div class="card">hi 2 off<span>a</span></div>`,
+		},
+		{
+			Name: "bad bool",
+			Tpl:  `<card title="hi" disabled="yes"></card>`,
+			Err:  `component "card": prop "disabled": cannot convert "yes" to bool`,
+		},
+		{
+			Name: "bind",
+			Tpl:  `<card :title="'hi'" :count="2" :disabled="false" :tags="['x', 'y']"></card>`,
+			Want: `<div class="card">hi 3 on<span>x</span><span>y</span></div>`,
+		},
+		{
+			Name: "dynamic component",
+			Tpl:  `<component is="card" title="hi" count="3"></component>`,
+			Want: `<div class="card">hi 4 on<span>a</span></div>`,
+		},
+		{
+			Name: "required",
+			Tpl:  "<div>\n  <card></card>\n</div>",
+			Err:  `main:2:3: component main: component "card": prop "title": missing required prop`,
+		},
+		{
+			Name: "bad number",
+			Tpl:  `<card title="hi" count="x"></card>`,
+			Err:  `main:1:1: component main: component "card": prop "count": cannot convert "x" to number`,
+		},
+		{
+			Name: "bad type",
+			Tpl:  `<card title="hi" :tags="1"></card>`,
+			Err:  `component "card": prop "tags": want array, got int64`,
+		},
+		{
+			Name: "bad type in dynamic component",
+			Tpl:  `<component is="card" :title="1"></component>`,
+			Err:  `dynamic component "card": prop "title": want string, got int64`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New()
+			err := v.ComponentTxt("main", c.Tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = v.ComponentTxt("card", card)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			html, err := v.RenderComponent("main", &vpl.RenderParam{})
+			if c.Err != "" {
+				var pe *vpl.PropError
+				if !errors.As(err, &pe) {
+					t.Fatalf("want PropError, get: %v, html: %s", err, html)
+				}
+				if !strings.Contains(err.Error(), c.Err) {
+					t.Fatalf("want: %s, get: %s", c.Err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != c.Want {
+				t.Fatalf("want: %s, get: %s", c.Want, html)
+			}
+		})
+	}
+}
+
+func TestComponentWithProps(t *testing.T) {
+	v := vpl.New()
+	err := v.ComponentWithProps("price", `<script props>['currency']</script><b>{{currency}}{{value * 2}}</b>`, []vpl.PropDef{
+		{Name: "value", Type: vpl.PropNumber, Required: true},
+		{Name: "currency", Type: vpl.PropString, Default: "$"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.ComponentTxt("main", `<p><price value="1.5"></price><price :value="2" currency="¥"></price></p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, err := v.RenderComponent("main", &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p><b>$3</b><b>¥4</b></p>`
+	if html != want {
+		t.Fatalf("want: %s, get: %s", want, html)
+	}
+
+	// RenderComponent传递的props也会被校验
+	_, err = v.RenderComponent("price", &vpl.RenderParam{})
+	if !errors.Is(err, vpl.ErrPropRequired) {
+		t.Fatalf("want ErrPropRequired, get: %v", err)
+	}
+}
+
+// 修改默认值不会影响之后的渲染
+func TestPropsDefaultCopy(t *testing.T) {
+	v := vpl.New()
+	v.Function("set", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		args[0].(map[string]interface{})[args[1].(string)] = args[2]
+		args[0].(map[string]interface{})["tags"].([]interface{})[0] = args[2]
+		return ""
+	})
+	err := v.ComponentTxt("card", `<script props>{opts: {type: Object, default: {a: 1, tags: ['x']}}}</script><p>{{opts.a}} {{opts.b}} {{opts.tags[0]}}{{set(opts, 'b', 2)}}</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		html, err := v.RenderComponent("card", &vpl.RenderParam{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `<p>1 null x</p>`
+		if html != want {
+			t.Fatalf("render %d, want: %s, get: %s", i, want, html)
+		}
+	}
+}
+
+func TestPropsDeclareError(t *testing.T) {
+	cases := []struct {
+		Name string
+		Tpl  string
+		Err  string
+	}{
+		{
+			Name: "unknown type",
+			Tpl:  "<script props>\n{a: 'date'}\n</script><p></p>",
+			Err:  `card:2:1: prop "a": unknown type "date"`,
+		},
+		{
+			Name: "bad default",
+			Tpl:  `<script props>{a: {type: Number, default: 'x'}}</script><p></p>`,
+			Err:  `card:1:15: prop "a": default: cannot convert "x" to number`,
+		},
+		{
+			Name: "syntax error",
+			Tpl:  `<script props>{a: </script><p></p>`,
+			Err:  `card:1:`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New()
+			err := v.ComponentTxt("card", c.Tpl)
+			if err == nil {
+				t.Fatal("want error")
+			}
+			if !strings.HasPrefix(err.Error(), c.Err) {
+				t.Fatalf("want: %s, get: %s", c.Err, err)
+			}
+		})
+	}
+}
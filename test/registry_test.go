@@ -0,0 +1,117 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+// 测试在渲染的同时注册组件, 需要使用 go test -race 运行
+func TestRegistryConcurrent(t *testing.T) {
+	v := vpl.New()
+	err := v.ComponentTxt("main", `<div><a-part></a-part>|<b-part></b-part>|{{ version }}</div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replace := func(i int) error {
+		return v.ReplaceTxt(map[string]string{
+			"a-part": fmt.Sprintf(`<span>%d</span>`, i),
+			"b-part": fmt.Sprintf(`<span>%d</span>`, i),
+		})
+	}
+	if err := replace(0); err != nil {
+		t.Fatal(err)
+	}
+	v.Global("version", 0)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	errs := make(chan error, 8)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				html, err := v.RenderComponent("main", &vpl.RenderParam{})
+				if err != nil {
+					errs <- err
+					return
+				}
+				// 一次渲染中的两个组件总是同一个版本
+				parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(html, "<div>"), "</div>"), "|")
+				if len(parts) != 3 || parts[0] != parts[1] {
+					errs <- fmt.Errorf("inconsistent render: %s", html)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= 200; i++ {
+		if err := replace(i); err != nil {
+			t.Fatal(err)
+		}
+		v.Global("version", i)
+		v.Directive(fmt.Sprintf("d%d", i), func(ctx *vpl.RenderCtx, nodeData *vpl.NodeData, binding *vpl.DirectivesBinding) {})
+		err := v.ComponentTxt(fmt.Sprintf("extra-%d", i), `<i></i>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.RemoveComponent(fmt.Sprintf("extra-%d", i-1))
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	html, err := v.RenderComponent("main", &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html != `<div><span>200</span>|<span>200</span>|200</div>` {
+		t.Fatal(html)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	v := vpl.New(vpl.WithStrict(true))
+	err := v.ComponentTxt("old", `<p>old</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 有错误时不会替换任何组件
+	err = v.ReplaceTxt(map[string]string{
+		"a": `<p>a</p>`,
+		"b": `<p>{{ (x }}</p>`,
+	}, "old")
+	var l vpl.ErrorList
+	if !errors.As(err, &l) || len(l) != 1 || !strings.HasPrefix(l[0].Error(), "b:1:") {
+		t.Fatalf("want ErrorList, get: %v", err)
+	}
+	if html := render(t, v, "old"); html != `<p>old</p>` {
+		t.Fatal(html)
+	}
+
+	v.Replace(map[string]vpl.Statement{
+		"a": &vpl.StrStatement{Str: `<p>a</p>`},
+	}, "old")
+	if html := render(t, v, "a"); html != `<p>a</p>` {
+		t.Fatal(html)
+	}
+	_, err = v.RenderComponent("old", &vpl.RenderParam{})
+	if !errors.Is(err, vpl.ErrComponentNotFound) {
+		t.Fatalf("want ErrComponentNotFound, get: %v", err)
+	}
+}
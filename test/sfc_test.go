@@ -0,0 +1,179 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+func TestSFC(t *testing.T) {
+	v := vpl.New()
+	err := v.ComponentTxt("card", `
+<template>
+  <div class="card"><h3 class="title">{{ title }}</h3><slot></slot></div>
+</template>
+
+<script>
+export default {
+  props: {title: {type: String, default: 'untitled'}},
+};
+</script>
+
+<style scoped>
+.card .title:hover, h3 { color: red }
+@media (max-width: 600px) {
+  .card { padding: 0 }
+}
+@keyframes fade { from { opacity: 0 } to { opacity: 1 } }
+</style>
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.ComponentTxt("badge", `<style>.badge { color: blue }</style><i class="badge"><slot></slot></i>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name   string
+		Tpl    string
+		Output string
+	}{
+		{
+			Name: "outlet",
+			Tpl:  `<html><head><vpl-styles></vpl-styles></head><body><card><badge>1</badge></card><card title="b"><badge>2</badge></card></body></html>`,
+			Output: `<html><head><style>.card .title[data-v-x]:hover, h3[data-v-x] { color: red }
+@media (max-width: 600px) {
+  .card[data-v-x] { padding: 0 }
+}
+@keyframes fade { from { opacity: 0 } to { opacity: 1 } }
+.badge { color: blue }</style></head>` +
+				`<body><div class="card" data-v-x><h3 class="title" data-v-x>untitled</h3><i class="badge">1</i></div>` +
+				`<div class="card" data-v-x><h3 class="title" data-v-x>b</h3><i class="badge">2</i></div></body></html>`,
+		},
+		{
+			// 没有<vpl-styles>时, 在第一次使用组件的地方输出
+			Name:   "inline",
+			Tpl:    `<div><badge>1</badge><badge>2</badge></div>`,
+			Output: `<div><style>.badge { color: blue }</style><i class="badge">1</i><i class="badge">2</i></div>`,
+		},
+		{
+			// 需要等待parallel中的组件
+			Name:   "parallel",
+			Tpl:    `<div><vpl-styles></vpl-styles><parallel><parallel><badge>1</badge></parallel></parallel></div>`,
+			Output: `<div><style>.badge { color: blue }</style><i class="badge">1</i></div>`,
+		},
+		{
+			Name:   "outlet in parallel",
+			Tpl:    `<div><parallel><vpl-styles></vpl-styles></parallel><badge>1</badge></div>`,
+			Output: `<div><style>.badge { color: blue }</style><i class="badge">1</i></div>`,
+		},
+	}
+
+	attr := `data-v-` + scopeID(t, v)
+	for _, c := range cases {
+		html, err := v.RenderTpl(c.Tpl, &vpl.RenderParam{})
+		if err != nil {
+			t.Fatal(c.Name, err)
+		}
+		want := strings.ReplaceAll(c.Output, "data-v-x", attr)
+		if html != want {
+			t.Fatalf("%s\nwant: %s\nget:  %s", c.Name, want, html)
+		}
+	}
+
+	// 流式渲染
+	err = v.ComponentTxt("page", `<html><head><vpl-styles></vpl-styles></head><body><parallel><badge>1</badge></parallel></body></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = v.RenderComponentTo(&buf, "page", &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `<html><head><style>.badge { color: blue }</style></head><body><i class="badge">1</i></body></html>` {
+		t.Fatal(buf.String())
+	}
+}
+
+// 从渲染结果中取出card组件的scoped属性
+func scopeID(t *testing.T, v *vpl.Vpl) string {
+	html := render(t, v, "card")
+	i := strings.Index(html, "data-v-")
+	if i == -1 {
+		t.Fatalf("missing scope attr: %s", html)
+	}
+	return html[i+len("data-v-") : i+len("data-v-")+8]
+}
+
+// 没有组件名的模板使用不同的scoped属性
+func TestSFCScopedTpl(t *testing.T) {
+	v := vpl.New()
+	tpl := func(color string) string {
+		return "<template><p>a</p></template>\n<style scoped>p { color: " + color + " }</style>"
+	}
+	scope := func(html string) string {
+		i := strings.Index(html, "data-v-")
+		if i == -1 {
+			t.Fatalf("missing scope attr: %s", html)
+		}
+		return html[i : i+len("data-v-")+8]
+	}
+
+	a, err := v.RenderTpl(tpl("red"), &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := v.RenderTpl(tpl("blue"), &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scope(a) == scope(b) {
+		t.Fatalf("want different scope attrs, get: %s, %s", a, b)
+	}
+}
+
+func TestSFCErrors(t *testing.T) {
+	cases := []struct {
+		Name string
+		Tpl  string
+		Err  string
+	}{
+		{
+			Name: "unexpected block",
+			Tpl:  "<template><p></p></template>\n<div></div>",
+			Err:  `c:2:1: unexpected <div> in single-file component`,
+		},
+		{
+			Name: "unknown option",
+			Tpl:  "<template><p></p></template>\n<script>export default {name: 'c'}</script>",
+			Err:  `c:2:9: unknown option "name"`,
+		},
+		{
+			Name: "lang",
+			Tpl:  "<template><p></p></template>\n<style lang=\"scss\"></style>",
+			Err:  `c:2:1: unsupported style lang "scss"`,
+		},
+	}
+
+	for _, c := range cases {
+		err := vpl.New().ComponentTxt("c", c.Tpl)
+		if err == nil || !strings.HasPrefix(err.Error(), c.Err) {
+			t.Fatalf("%s: want %s, get: %v", c.Name, c.Err, err)
+		}
+	}
+
+	// 不是SFC时, <script>会被原样渲染
+	v := vpl.New()
+	err := v.ComponentTxt("c", `<div><p></p></div><script>var a = 1</script>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html := render(t, v, "c"); html != `<div><p></p></div><script>var a = 1</script>` {
+		t.Fatal(html)
+	}
+}
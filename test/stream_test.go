@@ -0,0 +1,139 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zbysir/vpl"
+)
+
+type flushRecorder struct {
+	bytes.Buffer
+	flushed []string
+	onFlush func()
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushed = append(f.flushed, f.String())
+	if f.onFlush != nil {
+		f.onFlush()
+		f.onFlush = nil
+	}
+}
+
+// 测试流式渲染
+func TestRenderComponentTo(t *testing.T) {
+	v := vpl.New()
+	err := v.ComponentTxt("main", `<html>
+<head><title>{{title}}</title></head>
+<body>
+	<parallel><p>{{ slow('a') }}</p></parallel>
+	<span>sync</span>
+	<parallel><p>{{ slow('b') }}</p></parallel>
+</body>
+</html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// slow会等待head被flush后才返回, 以此验证head在parallel完成之前就被写出
+	release := make(chan struct{})
+	v.Function("slow", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		select {
+		case <-release:
+			return args[0]
+		case <-time.After(time.Second):
+			return "timeout"
+		}
+	})
+
+	props := vpl.NewProps()
+	props.Append("title", "stream")
+
+	w := &flushRecorder{onFlush: func() { close(release) }}
+	err = v.RenderComponentTo(w, "main", &vpl.RenderParam{
+		Ctx:            context.Background(),
+		Props:          props,
+		FlushAfterHead: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<html><head><title>stream</title></head><body><p>a</p><span>sync</span><p>b</p></body></html>`
+	if w.String() != want {
+		t.Fatalf("want: %s, get: %s", want, w.String())
+	}
+	if len(w.flushed) == 0 || !strings.Contains(w.flushed[0], "</head>") || strings.Contains(w.flushed[0], "<p>") {
+		t.Fatalf("head was not flushed first: %q", w.flushed)
+	}
+
+	// 与RenderComponent的结果一致
+	html, err := v.RenderComponent("main", &vpl.RenderParam{Props: props})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html != want {
+		t.Fatalf("want: %s, get: %s", want, html)
+	}
+}
+
+// 并发安全的Writer
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+// 已经完成的parallel以及它之后的内容在渲染结束之前就会被写出
+func TestRenderComponentToAfterParallel(t *testing.T) {
+	v := vpl.New()
+	err := v.ComponentTxt("main", `<div><parallel><p>a</p></parallel><span>b</span><parallel><p>{{ slow() }}</p></parallel>{{ wait() }}<i>c</i></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &syncBuffer{}
+	release := make(chan struct{})
+	v.Function("slow", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		<-release
+		return "d"
+	})
+	// 在渲染中等待之前的内容被写出
+	v.Function("wait", func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+		defer close(release)
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			// 第二个parallel还没有完成, 它之后的内容不会被写出
+			if strings.Contains(w.String(), "<span>b</span>") {
+				return "written"
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return "timeout"
+	})
+
+	err = v.RenderComponentTo(w, "main", &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<div><p>a</p><span>b</span><p>d</p>written<i>c</i></div>`
+	if w.String() != want {
+		t.Fatalf("want: %s, get: %s", want, w.String())
+	}
+}
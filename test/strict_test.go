@@ -0,0 +1,150 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+// 测试严格模式
+func TestStrict(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Tpl    string
+		Err    error
+		Errstr string
+		Want   string // 非严格模式下的输出
+	}{
+		{
+			Name:   "unknown component",
+			Tpl:    "<div>\n  <card></card>\n</div>",
+			Err:    vpl.ErrComponentNotFound,
+			Errstr: `main:2:3: component main: component "card": component not found`,
+			Want:   `<div><card data-err="not found component"></card></div>`,
+		},
+		{
+			Name:   "unknown dynamic component",
+			Tpl:    `<div><component :is="name"></component></div>`,
+			Err:    vpl.ErrComponentNotFound,
+			Errstr: `main:1:6: component main: component "component": dynamic component "card": component not found`,
+			Want:   `<div></div>`,
+		},
+		{
+			Name:   "undefined variable",
+			Tpl:    `<div>{{ member.name }}</div>`,
+			Err:    vpl.ErrUndefinedVariable,
+			Errstr: `main:1:8: component main: {{}} " member.name ": undefined variable: member`,
+			Want:   `<div>null</div>`,
+		},
+		{
+			Name:   "undefined property",
+			Tpl:    `<div>{{ user.nmae }}</div>`,
+			Err:    vpl.ErrUndefinedVariable,
+			Errstr: `main:1:8: component main: {{}} " user.nmae ": undefined variable: user.nmae`,
+			Want:   `<div>null</div>`,
+		},
+		{
+			Name:   "undefined index",
+			Tpl:    `<div v-for="i in [0, 2]">{{ user.tags[i] }}</div>`,
+			Err:    vpl.ErrUndefinedVariable,
+			Errstr: `undefined variable: user.tags[i]`,
+			Want:   `<div>a</div><div>null</div>`,
+		},
+		{
+			Name: "defined variable",
+			Tpl:  `<div><p v-if="empty == null">{{ name }}{{ undefined == null }}{{ user.name }}{{ user['age'] == null }}{{ user.tags.length }}</p><my-element></my-element></div>`,
+			Want: `<div><p>cardtruebobtrue2</p><my-element></my-element></div>`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			for _, strict := range []bool{true, false} {
+				v := vpl.New(vpl.WithStrict(strict))
+				err := v.ComponentTxt("main", c.Tpl)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				props := vpl.NewProps()
+				props.Append("name", "card")
+				props.Append("empty", nil)
+				props.Append("user", map[string]interface{}{"name": "bob", "age": nil, "tags": []interface{}{"a", "b"}})
+				html, err := v.RenderComponent("main", &vpl.RenderParam{Props: props})
+				if strict && c.Err != nil {
+					if !errors.Is(err, c.Err) {
+						t.Fatalf("want %v, get: %v, html: %s", c.Err, err, html)
+					}
+					if !strings.Contains(err.Error(), c.Errstr) {
+						t.Fatalf("want: %s, get: %s", c.Errstr, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if html != c.Want {
+					t.Fatalf("want: %s, get: %s", c.Want, html)
+				}
+			}
+		})
+	}
+}
+
+// 严格模式下没有传递的可选prop为null
+func TestStrictOptionalProp(t *testing.T) {
+	v := vpl.New(vpl.WithStrict(true))
+	err := v.ComponentTxt("card", `<script props>{title: String, size: Number}</script><p>{{ title }}{{ size == null }}</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.ComponentTxt("main", `<card title="a"></card>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, err := v.RenderComponent("main", &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html != `<p>atrue</p>` {
+		t.Fatal(html)
+	}
+}
+
+func TestCheckComponents(t *testing.T) {
+	v := vpl.New()
+	err := v.ComponentFile("main", "./strict/main.vue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.ComponentTxt("card", `<div class="card"><slot></slot><icon></icon></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = v.CheckComponents()
+	var errs vpl.ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("want ErrorList, get: %v", err)
+	}
+	want := `card:1:32: component card: component "icon": component not found
+./strict/main.vue:3:5: component main: component "avatar": component not found
+./strict/main.vue:5:3: component main: component "layout": component not found`
+	if err.Error() != want {
+		t.Fatalf("want:\n%s\nget:\n%s", want, err)
+	}
+
+	// 注册之后就不再报错
+	for _, name := range []string{"icon", "avatar", "layout"} {
+		err = v.ComponentTxt(name, `<i></i>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = v.CheckComponents()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
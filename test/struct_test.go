@@ -0,0 +1,343 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zbysir/vpl"
+)
+
+type Base struct {
+	ID      int64 `json:"id"`
+	Created string
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+type Status int
+
+type Post struct {
+	Base
+	*Author
+	Title   string `json:"title"`
+	Secret  string `json:"-"`
+	Status  Status
+	Tags    []Tag          `json:"tags"`
+	Scores  [3]int         `json:"scores"`
+	Meta    map[string]int `json:"meta"`
+	Editor  *Author
+	private string
+}
+
+type Author struct {
+	Name string `json:"author"`
+}
+
+// 测试直接读取go中的struct/map/slice, 不再需要vpl.Copy
+func TestStruct(t *testing.T) {
+	post := &Post{
+		Base:    Base{ID: 1, Created: "today"},
+		Author:  &Author{Name: "bysir"},
+		Title:   "hello",
+		Secret:  "secret",
+		Status:  2,
+		Tags:    []Tag{{Name: "go"}, {Name: "vue"}},
+		Scores:  [3]int{1, 2, 3},
+		Meta:    map[string]int{"views": 10},
+		private: "private",
+	}
+
+	cases := []struct {
+		Name string
+		Tpl  string
+		Want string
+	}{
+		{
+			Name: "json tag",
+			Tpl:  `<p>{{post.id}} {{post.title}} {{post.Created}}</p>`,
+			Want: `<p>1 hello today</p>`,
+		},
+		{
+			Name: "embedded pointer",
+			Tpl:  `<p>{{post.author}}</p>`,
+			Want: `<p>bysir</p>`,
+		},
+		{
+			Name: "skip json:- and unexported field",
+			Tpl:  `<p>{{post.Secret}}{{post.private}}{{post.Title}}</p>`,
+			Want: `<p>nullnullnull</p>`,
+		},
+		{
+			Name: "typed slice",
+			Tpl:  `<ul><li v-for="(tag, i) in post.tags">{{i}}:{{tag.name}}</li></ul><p>{{post.tags.length}} {{post.tags[1].name}}</p>`,
+			Want: `<ul><li>0:go</li><li>1:vue</li></ul><p>2 vue</p>`,
+		},
+		{
+			Name: "array",
+			Tpl:  `<p><span v-for="s in post.scores">{{s * 2}}</span>{{post.scores.length}}</p>`,
+			Want: `<p><span>2</span><span>4</span><span>6</span>3</p>`,
+		},
+		{
+			Name: "typed map",
+			Tpl:  `<p>{{post.meta.views + 1}} {{post.meta['views']}}</p>`,
+			Want: `<p>11 10</p>`,
+		},
+		{
+			Name: "named number",
+			Tpl:  `<p v-if="post.Status == 2">{{post.Status + 1}}</p>`,
+			Want: `<p>3</p>`,
+		},
+		{
+			Name: "nil pointer",
+			Tpl:  `<p>{{empty.title}}{{empty.author}}</p>`,
+			Want: `<p>null</p>`,
+		},
+		{
+			// nil的指针/map/slice与值为0的自定义类型为false
+			Name: "nil field",
+			Tpl:  `<p><b v-if="post.Editor">editor</b><b v-if="!empty.Editor">no editor</b><b v-if="empty.Meta || empty.Tags || empty.Status">x</b>{{ empty.Editor && empty.Editor.author }}</p>`,
+			Want: `<p><b>no editor</b>null</p>`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New()
+			err := v.ComponentTxt("main", c.Tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			props := vpl.NewProps()
+			props.Append("post", post)
+			props.Append("empty", &Post{})
+			html, err := v.RenderComponent("main", &vpl.RenderParam{Props: props})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != c.Want {
+				t.Fatalf("want: %s, get: %s", c.Want, html)
+			}
+		})
+	}
+}
+
+type Money float64
+
+func (m Money) Format(format string) string {
+	return fmt.Sprintf(format, float64(m))
+}
+
+type Order struct {
+	Total Money
+	Items []string
+}
+
+func (o *Order) Count() int {
+	return len(o.Items)
+}
+
+func (o *Order) Add(item string) int {
+	o.Items = append(o.Items, item)
+	return len(o.Items)
+}
+
+// 未导出的方法不能在模板中调用
+func (o Order) first() string {
+	return o.Items[0]
+}
+
+func (o Order) Join(sep string, prefix ...string) string {
+	return strings.Join(prefix, "") + strings.Join(o.Items, sep)
+}
+
+func (o Order) Check(n int) (bool, error) {
+	if n < 0 {
+		return false, errors.New("negative")
+	}
+	return n < len(o.Items), nil
+}
+
+func (p *Post) FullTitle() string {
+	return p.Title + " by " + p.Author.Name
+}
+
+// 测试在模板中调用go方法
+func TestMethod(t *testing.T) {
+	post := &Post{Title: "hello", Author: &Author{Name: "bysir"}}
+	order := Order{Total: 12.5, Items: []string{"a", "b"}}
+
+	cases := []struct {
+		Name string
+		Tpl  string
+		Want string
+		Err  string
+	}{
+		{
+			Name: "pointer receiver",
+			Tpl:  `<p>{{ post.FullTitle() }}</p>`,
+			Want: `<p>hello by bysir</p>`,
+		},
+		{
+			Name: "method of field",
+			Tpl:  `<p>{{ order.Total.Format('%.2f') }}</p>`,
+			Want: `<p>12.50</p>`,
+		},
+		{
+			Name: "pointer receiver on value",
+			Tpl:  `<p>{{ order.Count() + 1 }}</p>`,
+			Want: `<p>3</p>`,
+		},
+		{
+			Name: "variadic",
+			Tpl:  `<p>{{ order.Join(', ') }}|{{ order.Join('-', '#', '$') }}</p>`,
+			Want: `<p>a, b|#$a-b</p>`,
+		},
+		{
+			Name: "convert number argument",
+			Tpl:  `<p v-if="order.Check(1)">yes</p>`,
+			Want: `<p>yes</p>`,
+		},
+		{
+			Name: "returned error",
+			Tpl:  `<p>{{ order.Check(-1) }}</p>`,
+			Err:  "call method Check: negative",
+		},
+		{
+			Name: "bad argument",
+			Tpl:  `<p>{{ order.Check('x') }}</p>`,
+			Err:  `call method Check: argument 0: cannot convert "x" to number`,
+		},
+		{
+			Name: "bad number of arguments",
+			Tpl:  `<p>{{ order.Check() }}</p>`,
+			Err:  `call method Check: want 1 arguments, got 0`,
+		},
+		{
+			Name: "pointer receiver on value is called on a copy",
+			Tpl:  `<p>{{ order.Add('c') }}|{{ order.Count() }}</p>`,
+			Want: `<p>3|2</p>`,
+		},
+		{
+			// 和不存在的方法一样
+			Name: "unexported method",
+			Tpl:  `<p>{{ order.first() }}</p>`,
+			Want: `<p>null</p>`,
+		},
+		{
+			Name: "function in map",
+			Tpl:  `<p>{{ helper.upper('a') }}</p>`,
+			Want: `<p>A</p>`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			v := vpl.New(vpl.WithMethods(func(t reflect.Type, name string) bool {
+				return true
+			}))
+			err := v.ComponentTxt("main", c.Tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			props := vpl.NewProps()
+			props.Append("post", post)
+			props.Append("order", order)
+			props.Append("helper", map[string]interface{}{
+				"upper": vpl.Function(func(ctx *vpl.RenderCtx, args ...interface{}) interface{} {
+					return strings.ToUpper(args[0].(string))
+				}),
+			})
+			html, err := v.RenderComponent("main", &vpl.RenderParam{Props: props})
+			if c.Err != "" {
+				var re *vpl.RenderError
+				if !errors.As(err, &re) {
+					t.Fatalf("want RenderError, get: %v, html: %s", err, html)
+				}
+				if re.Err.Error() != c.Err {
+					t.Fatalf("want: %s, get: %s", c.Err, re.Err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != c.Want {
+				t.Fatalf("want: %s, get: %s", c.Want, html)
+			}
+		})
+	}
+}
+
+// 测试只有WithMethods允许的方法才能被调用, 不允许的方法和不存在的方法一样
+func TestMethodAllow(t *testing.T) {
+	order := Order{Total: 12.5, Items: []string{"a", "b"}}
+
+	cases := []struct {
+		Name  string
+		Allow func(t reflect.Type, name string) bool
+		Tpl   string
+		Want  string
+	}{
+		{
+			Name: "disabled by default",
+			Tpl:  `<p>{{ order.Count() }}</p>`,
+			Want: `<p>null</p>`,
+		},
+		{
+			Name: "allowed type",
+			Allow: func(t reflect.Type, name string) bool {
+				return t == reflect.TypeOf(Money(0))
+			},
+			Tpl:  `<p>{{ order.Total.Format('%.2f') }}</p>`,
+			Want: `<p>12.50</p>`,
+		},
+		{
+			Name: "not allowed type",
+			Allow: func(t reflect.Type, name string) bool {
+				return t == reflect.TypeOf(Money(0))
+			},
+			Tpl:  `<p>{{ order.Count() }}</p>`,
+			Want: `<p>null</p>`,
+		},
+		{
+			// 指针接收者的方法在值上调用时, 判断的是值本身的类型
+			Name: "pointer receiver on value",
+			Allow: func(t reflect.Type, name string) bool {
+				return t == reflect.TypeOf(Order{}) && name == "Count"
+			},
+			Tpl:  `<p>{{ order.Count() }}</p>`,
+			Want: `<p>2</p>`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var opts []vpl.Options
+			if c.Allow != nil {
+				opts = append(opts, vpl.WithMethods(c.Allow))
+			}
+			v := vpl.New(opts...)
+			err := v.ComponentTxt("main", c.Tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			props := vpl.NewProps()
+			props.Append("order", order)
+			html, err := v.RenderComponent("main", &vpl.RenderParam{Props: props})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != c.Want {
+				t.Fatalf("want: %s, get: %s", c.Want, html)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/zbysir/vpl"
+)
+
+// 修改文件, 并修改mtime保证能被检查到
+func writeFile(t *testing.T, name string, content string) {
+	t.Helper()
+	err := os.WriteFile(name, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt := time.Now().Add(time.Duration(len(content)) * time.Second)
+	err = os.Chtimes(name, mt, mt)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func render(t *testing.T, v *vpl.Vpl, name string) string {
+	t.Helper()
+	html, err := v.RenderComponent(name, &vpl.RenderParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return html
+}
+
+// 读取文件时调用open的fs
+type hookFS struct {
+	fs.FS
+	open func(name string)
+}
+
+func (h *hookFS) Open(name string) (fs.File, error) {
+	if h.open != nil {
+		h.open(name)
+	}
+	return h.FS.Open(name)
+}
+
+// 重新加载期间注册的组件不会被旧的文件内容覆盖
+func TestReloadConcurrentRegister(t *testing.T) {
+	m := fstest.MapFS{
+		"ui/card.vue": {Data: []byte(`<p>card</p>`)},
+	}
+	fsys := &hookFS{FS: m}
+	v := vpl.New()
+	err := v.LoadFS(fsys, "ui", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m["ui/card.vue"] = &fstest.MapFile{Data: []byte(`<p>new card</p>`), ModTime: time.Now()}
+	fsys.open = func(name string) {
+		if name != "ui/card.vue" {
+			return
+		}
+		fsys.open = nil
+		err := v.ComponentTxt("card", `<p>txt</p>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := v.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("want nothing, get: %v", names)
+	}
+	if html := render(t, v, "card"); html != `<p>txt</p>` {
+		t.Fatal(html)
+	}
+}
+
+// 测试热更新
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "main.vue"), `<div><card></card></div>`)
+	err := os.Mkdir(filepath.Join(dir, "ui"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "ui", "card.vue"), `<p>card</p>`)
+	writeFile(t, filepath.Join(dir, "ui", "tag.vue"), `<i>tag</i>`)
+
+	v := vpl.New(vpl.WithStrict(true))
+	err = v.ComponentFile("main", filepath.Join(dir, "main.vue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.LoadFS(os.DirFS(dir), "ui", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if html := render(t, v, "main"); html != `<div><p>card</p></div>` {
+		t.Fatal(html)
+	}
+
+	// 没有修改
+	names, err := v.Reload()
+	if err != nil || len(names) != 0 {
+		t.Fatalf("want nothing, get: %v, %v", names, err)
+	}
+
+	// 修改文件
+	writeFile(t, filepath.Join(dir, "main.vue"), `<section><card></card></section>`)
+	writeFile(t, filepath.Join(dir, "ui", "card.vue"), `<p>new card</p>`)
+	names, err = v.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "main,card,tag" {
+		t.Fatalf("want main,card,tag, get: %v", names)
+	}
+	if html := render(t, v, "main"); html != `<section><p>new card</p></section>` {
+		t.Fatal(html)
+	}
+
+	// 编译失败时保留之前的版本, 其他文件照常更新
+	writeFile(t, filepath.Join(dir, "main.vue"), `<section>{{ (x }}</section>`)
+	writeFile(t, filepath.Join(dir, "ui", "card.vue"), `<p v-if="a +">card</p>`)
+	writeFile(t, filepath.Join(dir, "ui", "tag.vue"), `<b>tag</b>`)
+	names, err = v.Reload()
+	var errs vpl.ErrorList
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("want 2 errors, get: %v", err)
+	}
+	if !strings.Contains(errs[0].Error(), "main.vue:1:") || !strings.HasPrefix(errs[1].Error(), "ui/card.vue:1:") {
+		t.Fatalf("want file names in errors, get: %v", err)
+	}
+	if strings.Join(names, ",") != "tag" {
+		t.Fatalf("want tag, get: %v", names)
+	}
+	if html := render(t, v, "main"); html != `<section><p>new card</p></section>` {
+		t.Fatal(html)
+	}
+	if html := render(t, v, "tag"); html != `<b>tag</b>` {
+		t.Fatal(html)
+	}
+
+	// 错误只会报告一次
+	_, err = v.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 修复之后恢复, 删除的文件对应的组件也被删除
+	writeFile(t, filepath.Join(dir, "ui", "card.vue"), `<p>fixed</p>`)
+	err = os.Remove(filepath.Join(dir, "ui", "tag.vue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html := render(t, v, "card"); html != `<p>fixed</p>` {
+		t.Fatal(html)
+	}
+	_, err = v.RenderComponent("tag", &vpl.RenderParam{})
+	if !errors.Is(err, vpl.ErrComponentNotFound) {
+		t.Fatalf("want ErrComponentNotFound, get: %v", err)
+	}
+
+	// 使用ComponentTxt重新注册之后不再关联文件
+	err = v.ComponentTxt("main", `<main></main>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "main.vue"), `<div>file</div>`)
+	names, _ = v.Reload()
+	if len(names) != 0 {
+		t.Fatalf("want nothing, get: %v", names)
+	}
+	if html := render(t, v, "main"); html != `<main></main>` {
+		t.Fatal(html)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.vue")
+	writeFile(t, file, `<p>1</p>`)
+
+	v := vpl.New()
+	err := v.ComponentFile("main", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reloaded := make(chan []string, 1)
+	failed := make(chan error, 1)
+	done := make(chan error)
+	go func() {
+		done <- v.Watch(ctx, &vpl.WatchOptions{
+			Interval: 10 * time.Millisecond,
+			OnReload: func(names []string) { reloaded <- names },
+			OnError:  func(err error) { failed <- err },
+		})
+	}()
+
+	writeFile(t, file, `<p>{{ (x }}</p>`)
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("want error")
+	}
+	if html := render(t, v, "main"); html != `<p>1</p>` {
+		t.Fatal(html)
+	}
+
+	writeFile(t, file, `<p>2</p>`)
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("want reload")
+	}
+	if html := render(t, v, "main"); html != `<p>2</p>` {
+		t.Fatal(html)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
@@ -154,7 +154,7 @@ func NicePrintStatement(st Statement, lev int) string {
 	case *tagStatement:
 		s += fmt.Sprintf("%sTag(%s, %+v", index, t.tag, t.tagStruct.Props)
 		if t.tagStruct.VBind != nil {
-			if t.tagStruct.VBind.useProps {
+			if t.tagStruct.VBind.useProps || t.tagStruct.VBind.useAttrs {
 				s += fmt.Sprintf(", BindProps")
 			}
 		}
@@ -206,6 +206,14 @@ func (s skipMarshalMap) MarshalJSON() ([]byte, error) {
 	return nil, nil
 }
 
+// $attrs: 调用组件时传递的、没有被声明为props的属性.
+// 与skipMarshalMap不同, 它们在v-bind时总是会被渲染为attr(而不需要经过CanBeAttrsKey判断)
+type attrsMap map[string]interface{}
+
+func alwaysAttr(string) bool {
+	return true
+}
+
 // Copy convert a complex structure to a structure containing only basic types.
 // Please refer to README.md#Admonition
 func Copy(i interface{}) (dst interface{}) {
@@ -1,30 +1,63 @@
 package vpl
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/valyala/bytebufferpool"
 	"github.com/zbysir/vpl/internal/parser"
-	"io/ioutil"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // 常驻实例, 一个程序只应该有一个实例.
 // 在运行期间是无副作用的
 type Vpl struct {
-	components map[string]Statement
-
-	// 类似原型链, 用于注册方法/等全局变量, 这些变量在每一个组件中都可以使用
-	prototype *Scope
-
-	// 指令
-	directives map[string]Directive
+	// 注册的组件/指令/全局变量(*registry), 见registry
+	reg atomic.Value
+	// 修改registry以及热更新的文件时加锁
+	mu sync.Mutex
 
 	// 什么prop可以被写成attr(编译时)
 	canBeAttrsKey func(k string) bool
 
 	skipComment bool
+
+	// 表达式出错时的处理方式
+	errorMode ErrorMode
+
+	// 一次渲染中同时执行的parallel数量, 0表示不限制
+	parallelLimit int
+
+	// 覆盖默认的html元素表(编译时)
+	elements map[string]bool
+
+	// 严格模式, 见WithStrict
+	strict bool
+
+	// 允许在模板中调用的go方法, 见WithMethods
+	methods func(t reflect.Type, name string) bool
+
+	// v-memo缓存的数量, 见WithMemoSize
+	memoSize int
+	// v-memo的渲染结果
+	memoCache *lruCache
+	// 组件缓存的渲染结果, 见WithCacheStore
+	cacheStore CacheStore
+
+	// 通过文件注册的组件, 用于热更新
+	files map[string]*fileSource
+	dirs  []*dirSource
+	// 同时只能有一个Reload
+	reloadMu sync.Mutex
 }
 
 type Options func(o *Vpl)
@@ -41,119 +74,220 @@ func WithSkipComment(skip bool) Options {
 	}
 }
 
+// WithErrorMode 设置表达式出错时的处理方式, 默认为ErrorModeAbort
+func WithErrorMode(mode ErrorMode) Options {
+	return func(o *Vpl) {
+		o.errorMode = mode
+	}
+}
+
+// WithElements 增加或覆盖html元素(编译时生效).
+// 值为true时tag会被当做html元素渲染, 为false时会被当做组件.
+//
+//  vpl.WithElements(map[string]bool{"amp-img": true, "header": false})
+func WithElements(elements map[string]bool) Options {
+	return func(o *Vpl) {
+		if o.elements == nil {
+			o.elements = make(map[string]bool, len(elements))
+		}
+		for k, v := range elements {
+			o.elements[k] = v
+		}
+	}
+}
+
+// WithParallelLimit 限制一次渲染中同时执行的<parallel>数量, 0表示不限制.
+// 可以被 RenderParam.ParallelLimit 覆盖
+func WithParallelLimit(n int) Options {
+	return func(o *Vpl) {
+		o.parallelLimit = n
+	}
+}
+
+// WithMemoSize 设置v-memo最多缓存多少个渲染结果, 超过时淘汰最久没有使用的结果. 默认为1000, 小于0时不缓存.
+func WithMemoSize(n int) Options {
+	return func(o *Vpl) {
+		o.memoSize = n
+	}
+}
+
+// WithCacheStore 设置保存组件缓存(CacheComponent)结果的CacheStore, 默认为 NewLRUCacheStore(1000).
+func WithCacheStore(s CacheStore) Options {
+	return func(o *Vpl) {
+		o.cacheStore = s
+	}
+}
+
+// WithMethods 允许在模板表达式中调用go值的导出方法, 如 {{ order.Total.Format('%.2f') }}.
+// 默认不允许调用任何方法, 因为模板可以调用传入的值上的所有导出方法(包括有副作用的方法);
+// allow用于判断类型t的name方法是否可以被调用, t是值本身的类型(对于非指针的值上的指针接收者方法, t也不是指针).
+func WithMethods(allow func(t reflect.Type, name string) bool) Options {
+	return func(o *Vpl) {
+		o.methods = allow
+	}
+}
+
+// WithStrict 开启严格模式: 调用不存在的组件或使用未定义的变量(包括对象上不存在的属性, 如 user.nmae)时渲染失败, 而不是输出空值.
+// 严格模式只在渲染时检查, 不会自动检查组件是否存在; 需要在所有组件注册完成后调用 CheckComponents 才能在编译期发现不存在的组件.
+func WithStrict(strict bool) Options {
+	return func(o *Vpl) {
+		o.strict = strict
+	}
+}
+
 // New return a Vpl instance,
 // This instance should be shared in multiple renderings.
 // The recommended practice is to have only one Vpl instance for the whole program.
 func New(options ...Options) *Vpl {
-	vpl := &Vpl{
-		components: map[string]Statement{
-			// 模板, 直接渲染子组件
-			// 注意, 所有slot执行都有"编译作用域的问题"(https://cn.vuejs.org/v2/guide/components-slots.html#%E7%BC%96%E8%AF%91%E4%BD%9C%E7%94%A8%E5%9F%9F)
-			// slot是在父组件声明并会使用变量, 却在子组件中运行, 所以在执行slot时需要使用父组件环境.
-			"template": FuncStatement(func(ctx *StatementCtx, o *StatementOptions) error {
-				if o.Slots == nil {
-					return nil
-				}
-				slot := o.Slots.Default
-				if slot == nil {
-					return nil
-				}
-				err := slot.Exec(ctx, nil)
-				if err != nil {
-					return nil
-				}
+	// 内置组件
+	builtins := map[string]Statement{
+		// 模板, 直接渲染子组件
+		// 注意, 所有slot执行都有"编译作用域的问题"(https://cn.vuejs.org/v2/guide/components-slots.html#%E7%BC%96%E8%AF%91%E4%BD%9C%E7%94%A8%E5%9F%9F)
+		// slot是在父组件声明并会使用变量, 却在子组件中运行, 所以在执行slot时需要使用父组件环境.
+		"template": FuncStatement(func(ctx *StatementCtx, o *StatementOptions) error {
+			if o.Slots == nil {
 				return nil
-			}),
-			// <slot name="abc" :abc=123>语句
-			// 注意, 所有slot执行都有"编译作用域的问题"(https://cn.vuejs.org/v2/guide/components-slots.html#%E7%BC%96%E8%AF%91%E4%BD%9C%E7%94%A8%E5%9F%9F)
-			// slot是在父组件声明并会使用变量, 却在子组件中运行, 所以在执行slot时需要使用父组件环境.
-			"slot": FuncStatement(func(ctx *StatementCtx, o *StatementOptions) error {
-				slotName := ""
-				attr, exist := o.Props.Get("name")
-				if exist {
-					slotName, _ = attr.(string)
-				}
-				var slot *Slot
-
-				p := o.Parent
-				if p.Slots != nil {
-					if slotName == "" {
-						slot = p.Slots.Default
-					} else {
-						slot = p.Slots.Get(slotName)
-					}
+			}
+			slot := o.Slots.Default
+			if slot == nil {
+				return nil
+			}
+			return slot.Exec(ctx, nil)
+		}),
+		// <slot name="abc" :abc=123>语句
+		// 注意, 所有slot执行都有"编译作用域的问题"(https://cn.vuejs.org/v2/guide/components-slots.html#%E7%BC%96%E8%AF%91%E4%BD%9C%E7%94%A8%E5%9F%9F)
+		// slot是在父组件声明并会使用变量, 却在子组件中运行, 所以在执行slot时需要使用父组件环境.
+		"slot": FuncStatement(func(ctx *StatementCtx, o *StatementOptions) error {
+			slotName := ""
+			attr, exist := o.Props.Get("name")
+			if exist {
+				slotName, _ = attr.(string)
+			}
+			var slot *Slot
+
+			p := o.Parent
+			if p.Slots != nil {
+				if slotName == "" {
+					slot = p.Slots.Default
+				} else {
+					slot = p.Slots.Get(slotName)
 				}
+			}
 
-				if slot == nil {
-					// 备选内容
-					if o.Slots != nil {
-						fullback := o.Slots.Default
-						if fullback != nil {
-							err := fullback.Exec(ctx, nil)
-							if err != nil {
-								return err
-							}
+			if slot == nil {
+				// 备选内容
+				if o.Slots != nil {
+					fullback := o.Slots.Default
+					if fullback != nil {
+						err := fullback.Exec(ctx, nil)
+						if err != nil {
+							return err
 						}
 					}
-
-					return nil
 				}
 
-				err := slot.Exec(ctx, o)
-				if err != nil {
-					return nil
-				}
 				return nil
-			}),
-			// <parallel> 并行语句
-			// 被parallel组件包裹起来的子组件都会被同时渲染,
-			// 假如有3个耗时组件分别用时 3/2/1 s, 如果都使用parallel组件包裹起来, 最终渲染耗时应该是 3 s.
-			"parallel": FuncStatement(func(ctx *StatementCtx, o *StatementOptions) error {
-				s := NewChanSpan()
-				go func() {
-					ctx := ctx.Clone()
-					ctx.W = NewListWriter()
-					child := o.Slots.Default
-					if child == nil {
-						s.Done("")
-						return
-					}
-					err := child.Exec(ctx, nil)
-					if err != nil {
-						s.Done(fmt.Sprintf("err: %+v", err))
-					} else {
-						s.Done(ctx.W.Result())
-					}
-				}()
+			}
 
-				ctx.W.WriteSpan(s)
+			return slot.Exec(ctx, o)
+		}),
+		// <parallel> 并行语句
+		// 被parallel组件包裹起来的子组件都会被同时渲染,
+		// 假如有3个耗时组件分别用时 3/2/1 s, 如果都使用parallel组件包裹起来, 最终渲染耗时应该是 3 s.
+		"parallel": FuncStatement(func(ctx *StatementCtx, o *StatementOptions) error {
+			// 渲染已经取消, 则不再启动新的协程
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			timeout, err := parallelTimeout(o.Props)
+			if err != nil {
+				return err
+			}
+			s := NewChanSpan()
+			ctx = ctx.Clone()
+			if ctx.state != nil {
+				ctx.parallelDone = ctx.state.start()
+			}
+			go func() {
+				html, err := execParallel(ctx, o, timeout)
+				ctx.parallelExecuted()
+				s.Done(html, err)
+			}()
 
+			ctx.W.WriteSpan(s)
+
+			return nil
+		}),
+		// 输出本次渲染中使用到的组件样式, 见 execStyleOutlet
+		"vpl-styles": FuncStatement(execStyleOutlet),
+		// 布局继承, 见 compileExtends
+		"block": FuncStatement(execBlock),
+		"super": FuncStatement(execSuper),
+		// 输出口, 见 execOutlet
+		"vpl-outlet": FuncStatement(execOutlet),
+		// 将内容渲染到输出口中, 见 execTeleport
+		"teleport": FuncStatement(func(ctx *StatementCtx, o *StatementOptions) error {
+			to := ""
+			if attr, exist := o.Props.Get("to"); exist {
+				to, _ = attr.(string)
+			}
+			if to == "" {
+				return errors.New("teleport: missing 'to' prop")
+			}
+			return execTeleport(ctx, o, to)
+		}),
+		"vpl-head": FuncStatement(func(ctx *StatementCtx, o *StatementOptions) error {
+			return execTeleport(ctx, o, "head")
+		}),
+		// 动态组件
+		"component": FuncStatement(func(ctx *StatementCtx, o *StatementOptions) error {
+			is := ""
+			attr, exist := o.Props.Get("is")
+			if exist {
+				is, _ = attr.(string)
+			}
+
+			if is == "" {
+				if ctx.Strict {
+					return fmt.Errorf("dynamic component: missing 'is' prop: %w", ErrComponentNotFound)
+				}
 				return nil
-			}),
-			// 动态组件
-			"component": FuncStatement(func(ctx *StatementCtx, o *StatementOptions) error {
-				is := ""
-				attr, exist := o.Props.Get("is")
-				if exist {
-					is, _ = attr.(string)
+			}
+			cp, exist := ctx.Components[is]
+			if !exist {
+				if ctx.Strict {
+					return fmt.Errorf("dynamic component %q: %w", is, ErrComponentNotFound)
 				}
+				return nil
+			}
 
-				if is == "" {
-					return nil
+			// is不是组件的属性
+			props := o.Props.omit("is")
+			exec := func(ctx *StatementCtx) error {
+				return cp.Exec(ctx, o)
+			}
+			if pc, ok := cp.(*declComponent); ok {
+				var err error
+				props, err = pc.applyProps(props)
+				if err != nil {
+					return fmt.Errorf("dynamic component %q: %w", is, err)
 				}
-				cp, exist := ctx.Components[is]
-				if !exist {
-					return nil
+				exec = func(ctx *StatementCtx) error {
+					return execComponent(ctx, cp, props, o.Slots, o.Parent)
 				}
+			}
 
-				return cp.Exec(ctx, o)
-			}),
-		},
-		prototype:     NewScope(nil),
-		directives:    map[string]Directive{},
+			return execCachedComponent(ctx, is, props, exec)
+		}),
+	}
+
+	vpl := &Vpl{
+		files:         map[string]*fileSource{},
 		canBeAttrsKey: DefaultCanBeAttr,
 		skipComment:   true,
+		memoSize:      1000,
 	}
+	vpl.reg.Store(newRegistry(builtins))
 
 	for _, o := range options {
 		o(vpl)
@@ -162,9 +296,139 @@ func New(options ...Options) *Vpl {
 	if vpl.canBeAttrsKey == nil {
 		vpl.canBeAttrsKey = DefaultCanBeAttr
 	}
+	if vpl.memoSize > 0 {
+		vpl.memoCache = newLRUCache(vpl.memoSize)
+	}
+	if vpl.cacheStore == nil {
+		vpl.cacheStore = NewLRUCacheStore(1000)
+	}
 	return vpl
 }
 
+// ErrParallelTimeout 在<parallel>执行超过timeout时返回
+var ErrParallelTimeout = errors.New("parallel timeout")
+
+// 读取parallel的timeout属性, 支持 "500ms" 格式的字符串, 数字则表示毫秒
+func parallelTimeout(props *Props) (time.Duration, error) {
+	attr, exist := props.Get("timeout")
+	if !exist || attr == nil {
+		return 0, nil
+	}
+	if ms, ok := isNumber(attr); ok {
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	t, ok := attr.(string)
+	if !ok {
+		return 0, fmt.Errorf("bad timeout of parallel: %v", attr)
+	}
+	if t == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(t)
+	if err != nil {
+		if ms, e := strconv.ParseFloat(t, 64); e == nil {
+			return time.Duration(ms * float64(time.Millisecond)), nil
+		}
+		return 0, fmt.Errorf("bad timeout of parallel: %w", err)
+	}
+	return d, nil
+}
+
+// 执行parallel的子节点
+// 当子节点出错或超时时, 如果声明了error slot(<template #error="e">), 则渲染error slot作为备选内容, 否则返回错误.
+// error slot的props: {message: 错误信息(不包含位置等调试信息), error: 错误}
+func execParallel(ctx *StatementCtx, o *StatementOptions, timeout time.Duration) (string, error) {
+	if o.Slots == nil || o.Slots.Default == nil {
+		return "", nil
+	}
+
+	html, err := runParallel(ctx, o.Slots.Default, timeout)
+	if err == nil {
+		return html, nil
+	}
+
+	fallback := o.Slots.Get("error")
+	// 渲染被取消时不需要渲染备选内容
+	if fallback == nil || ctx.Err() != nil {
+		return "", err
+	}
+
+	message := err.Error()
+	var re *RenderError
+	if errors.As(err, &re) {
+		message = re.Err.Error()
+	}
+	props := NewProps()
+	props.Append("message", message)
+	props.Append("error", err)
+
+	if ctx.memo != nil {
+		ctx.memo.addFallback()
+	}
+	ctx = ctx.Clone()
+	ctx.W = NewListWriter()
+	err = fallback.Exec(ctx, &StatementOptions{Props: props})
+	ctx.parallelExecuted()
+	if err != nil {
+		return "", err
+	}
+	return ctx.W.Result()
+}
+
+// 在timeout时间内执行slot, 超时后会取消子节点的context.
+// 先获取parallel的执行名额再开始计时, 排队等待的时间不算在timeout中
+func runParallel(ctx *StatementCtx, slot *Slot, timeout time.Duration) (string, error) {
+	err := ctx.acquireParallel()
+	if err != nil {
+		return "", err
+	}
+	if timeout <= 0 {
+		return runSlot(ctx, slot)
+	}
+
+	parent := ctx.Ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	c, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	child := ctx.Clone()
+	child.Ctx = c
+
+	r := make(chan spanResult, 1)
+	go func() {
+		s, err := runSlot(child, slot)
+		r <- spanResult{s: s, err: err}
+	}()
+
+	select {
+	case x := <-r:
+		return x.s, x.err
+	case <-c.Done():
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%w after %s", ErrParallelTimeout, timeout)
+	}
+}
+
+// 在新的Writer中执行slot, 调用之前需要获取parallel的执行名额, 执行完成后释放
+func runSlot(ctx *StatementCtx, slot *Slot) (string, error) {
+	ctx = ctx.Clone()
+	ctx.W = NewListWriter()
+
+	err := slot.Exec(ctx, nil)
+	// 在等待子span之前就释放, 否则嵌套的parallel可能会因为拿不到名额而死锁
+	ctx.releaseParallel()
+	if err != nil {
+		return "", err
+	}
+	// 出错时会在执行备选内容之后才算执行完成, 见execParallel
+	ctx.parallelExecuted()
+
+	return ctx.W.Result()
+}
+
 var DefaultCanBeAttr = func(k string) bool {
 	if k == "id" {
 		return true
@@ -177,22 +441,170 @@ var DefaultCanBeAttr = func(k string) bool {
 }
 
 func (v *Vpl) Component(name string, c Statement) (err error) {
-	v.components[name] = c
+	v.update([]*compiledComponent{{name: name, statement: c}}, nil)
+	return nil
+}
+
+// RemoveComponent 删除组件, 正在进行的渲染不受影响
+func (v *Vpl) RemoveComponent(name string) {
+	v.update(nil, []string{name})
+}
+
+// Replace 一次性注册components并删除remove中的组件, 渲染时只会看到全部替换之前或者之后的组件.
+func (v *Vpl) Replace(components map[string]Statement, remove ...string) {
+	set := make([]*compiledComponent, 0, len(components))
+	for name, c := range components {
+		set = append(set, &compiledComponent{name: name, statement: c})
+	}
+	v.update(set, remove)
+}
+
+// ReplaceTxt 与Replace相同, 但使用模板注册组件.
+// 所有模板都编译成功之后才会替换, 否则返回包含所有错误的ErrorList.
+func (v *Vpl) ReplaceTxt(components map[string]string, remove ...string) error {
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs ErrorList
+	set := make([]*compiledComponent, 0, len(components))
+	for _, name := range names {
+		cp, err := v.compileSource(name, name, components[name], nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		set = append(set, cp)
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+
+	v.update(set, remove)
+	return nil
+}
+
+// 注册与删除组件, 见registry
+func (v *Vpl) update(set []*compiledComponent, remove []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.updateLocked(set, remove)
+}
+
+func (v *Vpl) updateLocked(set []*compiledComponent, remove []string) {
+	v.modifyLocked(func(r *registry) {
+		r.setComponents(set, remove)
+	})
+
+	for _, name := range remove {
+		delete(v.files, name)
+	}
+	for _, cp := range set {
+		// 重新注册的组件不再与之前的文件关联
+		if cp.file != nil {
+			v.files[cp.name] = cp.file
+		} else {
+			delete(v.files, cp.name)
+		}
+	}
+}
+
+// CheckComponents 检查所有组件中静态调用的组件是否都已经注册, 应该在所有组件注册完成后调用.
+// 会返回所有找到的错误(ErrorList), 每个错误都包含调用的位置.
+// 动态组件(<component :is>)与未注册的自定义元素(如<my-element>)不会被检查.
+func (v *Vpl) CheckComponents() error {
+	r := v.load()
+	components, allRefs := r.components, r.refs
+
+	names := make([]string, 0, len(allRefs))
+	for name := range allRefs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs ErrorList
+	for _, name := range names {
+		for _, ref := range allRefs[name] {
+			if _, exist := components[ref.Name]; exist {
+				continue
+			}
+			errs = append(errs, &RenderError{
+				Component: name,
+				Statement: "component",
+				Code:      ref.Name,
+				Pos:       ref.Pos,
+				Err:       ErrComponentNotFound,
+			})
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
 	return nil
 }
 
 // Declare a component by file
+// 通过文件注册的组件可以被热更新, 见 Watch
 func (v *Vpl) ComponentFile(name string, path string) (err error) {
-	fileBs, err := ioutil.ReadFile(path)
+	f := &fileSource{name: name, path: path}
+	cp, err := v.compileFile(f)
 	if err != nil {
-		return fmt.Errorf("readFile err: %w", err)
+		return
 	}
 
-	return v.ComponentTxt(name, string(fileBs))
+	v.update([]*compiledComponent{cp}, nil)
+	return
 }
 
 // Declare a component by txt
 func (v *Vpl) ComponentTxt(name string, txt string) (err error) {
+	return v.componentSource(name, name, txt, nil)
+}
+
+// ComponentWithProps 声明一个组件, 并声明它的props.
+// 调用组件时会填充默认值, 将字符串属性转换为声明的类型, 并在校验失败时返回错误.
+// 与模板中的<script props>声明同名时, 以props为准.
+//
+//	v.ComponentWithProps("card", tpl, []vpl.PropDef{
+//	    {Name: "title", Type: vpl.PropString, Required: true},
+//	    {Name: "count", Type: vpl.PropNumber, Default: 1},
+//	})
+func (v *Vpl) ComponentWithProps(name string, txt string, props []PropDef) (err error) {
+	defs := make([]PropDef, len(props))
+	for i, def := range props {
+		if def.Default != nil {
+			def.Default, err = coerceProp(def.Name, def.Default, def.Type)
+			if err != nil {
+				return fmt.Errorf("prop %q: default: %w", def.Name, err)
+			}
+		}
+		defs[i] = def
+	}
+	return v.componentSource(name, name, txt, defs)
+}
+
+// 编译并注册组件, filename用于在出错时提示, props是在go中声明的props
+func (v *Vpl) componentSource(name string, filename string, txt string, props []PropDef) (err error) {
+	cp, err := v.compileSource(name, filename, txt, props)
+	if err != nil {
+		return
+	}
+
+	return v.register(cp)
+}
+
+// 编译好但还没有注册的组件
+type compiledComponent struct {
+	name      string
+	statement Statement
+	refs      []componentRef
+	// 通过ComponentFile注册的组件所在的文件
+	file *fileSource
+}
+
+func (v *Vpl) compileSource(name string, filename string, txt string, props []PropDef) (*compiledComponent, error) {
 	// 类似以下代码中的v-slot是无效的写法.
 	// <template>
 	//   <h1 v-slot><h1>
@@ -206,38 +618,83 @@ func (v *Vpl) ComponentTxt(name string, txt string) (err error) {
 	// 在这个情况下, 编译组件不会返回slot(此时的slot被存放在ComponentStatement上).
 	//
 	// 综上, 这里不需要管ParseHtmlToStatement返回的slots值.
-	s, _, err := ParseHtmlToStatement(txt, &parser.ParseVueNodeOptions{
+	c := &compiler{component: name, elements: v.elements}
+	s, _, err := compileComponent(c, filename, txt, &parser.ParseVueNodeOptions{
 		CanBeAttr:   v.canBeAttrsKey,
 		SkipComment: v.skipComment,
 	})
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	return v.Component(name, s)
+	if c.props != nil || props != nil || c.style != "" {
+		dc := &declComponent{Statement: s, name: name, style: c.style}
+		if c.props != nil || props != nil {
+			dc.props = mergePropDefs(c.props, props)
+		}
+		s = dc
+	}
+
+	return &compiledComponent{name: name, statement: s, refs: c.refs}, nil
+}
+
+func (v *Vpl) register(cp *compiledComponent) (err error) {
+	v.update([]*compiledComponent{cp}, nil)
+	return
 }
 
 // Global 设置全局变量, 在所有的组件中都生效
 // 也可用于设置全局方法
 func (v *Vpl) Global(name string, val interface{}) () {
-	v.prototype.Set(name, val)
+	v.modify(func(r *registry) {
+		r.setGlobal(name, val)
+	})
 	return
 }
 
 // Function 是对 Global 方法设置全局方法的再次封装
 func (v *Vpl) Function(name string, val Function) () {
-	v.prototype.Set(name, val)
+	v.Global(name, val)
+	return
+}
+
+// Func 注册任意go方法为全局方法, 参数会自动从模板中的值转换为声明的类型, 支持可变参数.
+// 方法的第一个参数可以是*RenderCtx或者context.Context(渲染的context), 最后一个返回值可以是error.
+// 参数转换失败或者方法返回error都会使渲染失败.
+//
+//  v.Func("add", func(a, b int) int { return a + b })
+//  v.Func("user", func(ctx context.Context, id int64) (*User, error) { ... })
+//
+// 如果fn不是方法则会panic.
+func (v *Vpl) Func(name string, fn interface{}) () {
+	if fn == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+		panic(fmt.Sprintf("vpl: Func %s: fn must be a func, got %T", name, fn))
+	}
+	v.Global(name, newReflectFunc(name, fn))
 	return
 }
 
 // Directive 声明一个指令
 func (v *Vpl) Directive(name string, val Directive) () {
-	v.directives[name] = val
+	v.modify(func(r *registry) {
+		r.setDirective(name, val)
+	})
 	return
 }
 
+// 生成用于限制parallel并发数量的信号量, limit为0时使用Vpl的设置, 小于0表示不限制
+func (v *Vpl) newParallelSem(limit int) chan struct{} {
+	if limit == 0 {
+		limit = v.parallelLimit
+	}
+	if limit <= 0 {
+		return nil
+	}
+	return make(chan struct{}, limit)
+}
+
 func (v *Vpl) NewScope() *Scope {
-	s := NewScope(v.prototype)
+	s := NewScope(v.load().prototype)
 	return s
 }
 
@@ -256,7 +713,8 @@ func (v *Vpl) RenderTpl(tpl string, p *RenderParam) (html string, err error) {
 	// 在这个情况下, 编译组件不会返回slot(此时的slot被存放在ComponentStatement上).
 	//
 	// 综上, 这里不需要管ParseHtmlToStatement返回的slots值.
-	statement, _, err := ParseHtmlToStatement(tpl, &parser.ParseVueNodeOptions{
+	comp := &compiler{elements: v.elements}
+	statement, _, err := compileComponent(comp, "", tpl, &parser.ParseVueNodeOptions{
 		CanBeAttr: v.canBeAttrsKey,
 	})
 	if err != nil {
@@ -265,27 +723,46 @@ func (v *Vpl) RenderTpl(tpl string, p *RenderParam) (html string, err error) {
 
 	var w = NewListWriter()
 
-	global := v.NewScope()
+	// 整个渲染使用同一个registry
+	r := v.load()
+	global := NewScope(r.prototype)
 
 	if p.Global != nil {
 		global = global.Extend(p.Global)
 	}
+	c := p.Ctx
+	if c == nil {
+		c = context.Background()
+	}
 	ctx := &StatementCtx{
 		Global:        global,
 		Store:         nil,
-		Ctx:           p.Ctx,
+		Ctx:           c,
 		W:             w,
-		Components:    v.components,
-		Directives:    v.directives,
+		Components:    r.components,
+		Directives:    r.directives,
 		CanBeAttrsKey: v.canBeAttrsKey,
+		ErrorMode:     v.errorMode,
+		Strict:        v.strict,
+		methods:       v.methods,
+		parallelSem:   v.newParallelSem(p.ParallelLimit),
+		state:         newRenderState(),
+		memoCache:     v.memoCache,
+		caches:        r.caches,
+		cacheStore:    v.cacheStore,
+		generation:    r.generation,
 	}
-
 	propsMap := p.Props.ToMap()
 	// 将所有props放入scope
 	scope := ctx.NewScope().Extend(propsMap)
 	// copyMap是为了让$props和scope的value不相等, 否则在打印$props就会出现循环引用.
 	scope.Set("$props", skipMarshalMap(propsMap))
+	// 模板没有声明props, $attrs与$props相同, 用于根节点继承属性
+	scope.Set("$attrs", skipMarshalMap(propsMap))
 
+	if comp.style != "" {
+		ctx.useStyle("", comp.style)
+	}
 	err = statement.Exec(ctx, &StatementOptions{
 		Slots:  nil,
 		Props:  p.Props,
@@ -293,16 +770,71 @@ func (v *Vpl) RenderTpl(tpl string, p *RenderParam) (html string, err error) {
 		Parent: nil,
 	})
 
+	// 在渲染执行完成之后, 输出口才能得到完整的内容
+	ctx.state.end()
+	if err != nil {
+		err = fmt.Errorf("RenderTpl err: %w", err)
+		return
+	}
+	html, err = w.Result()
+	if err == nil {
+		// 在等待parallel时渲染可能被取消
+		err = ctx.Err()
+	}
 	if err != nil {
 		err = fmt.Errorf("RenderTpl err: %w", err)
+		html = ""
 		return
 	}
-	html = w.Result()
 	return
 }
 
 // 渲染一个已经编译好的组件
 func (v *Vpl) RenderComponent(component string, p *RenderParam) (html string, err error) {
+	var w = NewListWriter()
+	err = v.renderComponent(component, p, w)
+	if err != nil {
+		err = fmt.Errorf("RenderComponent err: %w", err)
+		return
+	}
+
+	html, err = w.Result()
+	if err == nil && p.Ctx != nil {
+		// 在等待parallel时渲染可能被取消
+		err = p.Ctx.Err()
+	}
+	if err != nil {
+		err = fmt.Errorf("RenderComponent err: %w", err)
+		html = ""
+		return
+	}
+	return
+}
+
+// RenderComponentTo 渲染组件并将结果流式写入w.
+// 同步的内容会被立即写入, 只有遇到未完成的<parallel>块时才会按顺序等待.
+// 如果设置了 RenderParam.FlushAfterHead 并且w实现了http.Flusher, 则会在写出</head>后立即Flush, 让浏览器提前加载资源.
+func (v *Vpl) RenderComponentTo(w io.Writer, component string, p *RenderParam) (err error) {
+	sw := newStreamWriter(w, p.FlushAfterHead)
+	err = v.renderComponent(component, p, sw)
+	if err != nil {
+		sw.abort()
+		err = fmt.Errorf("RenderComponent err: %w", err)
+		return
+	}
+
+	err = sw.Close()
+	if err == nil && p.Ctx != nil {
+		err = p.Ctx.Err()
+	}
+	if err != nil {
+		err = fmt.Errorf("RenderComponent err: %w", err)
+		return
+	}
+	return
+}
+
+func (v *Vpl) renderComponent(component string, p *RenderParam, w Writer) (err error) {
 	statement := ComponentStatement{
 		ComponentKey: component,
 		ComponentStruct: ComponentStruct{
@@ -314,39 +846,46 @@ func (v *Vpl) RenderComponent(component string, p *RenderParam) (html string, er
 		},
 	}
 
-	var w = NewListWriter()
-
-	global := v.NewScope()
+	// 整个渲染使用同一个registry
+	r := v.load()
+	global := NewScope(r.prototype)
 
 	if p.Global != nil {
 		global = global.Extend(p.Global)
 	}
+	c := p.Ctx
+	if c == nil {
+		c = context.Background()
+	}
 	ctx := &StatementCtx{
 		Global:        global,
 		Store:         p.Store,
-		Ctx:           p.Ctx,
+		Ctx:           c,
 		W:             w,
-		Components:    v.components,
-		Directives:    v.directives,
+		Components:    r.components,
+		Directives:    r.directives,
 		CanBeAttrsKey: v.canBeAttrsKey,
+		ErrorMode:     v.errorMode,
+		Strict:        v.strict,
+		methods:       v.methods,
+		parallelSem:   v.newParallelSem(p.ParallelLimit),
+		state:         newRenderState(),
+		memoCache:     v.memoCache,
+		caches:        r.caches,
+		cacheStore:    v.cacheStore,
+		generation:    r.generation,
 	}
+	// 在渲染执行完成之后, 输出口才能得到完整的内容
+	defer ctx.state.end()
 
 	scope := ctx.NewScope()
 	scope.Set("$props", p.Props)
-	err = statement.Exec(ctx, &StatementOptions{
+	return statement.Exec(ctx, &StatementOptions{
 		Slots:  nil,
 		Props:  p.Props,
 		Scope:  scope,
 		Parent: nil,
 	})
-
-	if err != nil {
-		err = fmt.Errorf("RenderComponent err: %w", err)
-		return
-	}
-
-	html = w.Result()
-	return
 }
 
 // 支持同时写Span和string的Write
@@ -358,11 +897,11 @@ type ListWriter struct {
 	spans []Span
 }
 
-func (p *ListWriter) Result() string {
+func (p *ListWriter) Result() (string, error) {
 	if len(p.spans) == 0 {
 		s := p.s.String()
 		p.s.Reset()
-		return s
+		return s, nil
 	}
 
 	if p.s.Len() != 0 {
@@ -372,10 +911,14 @@ func (p *ListWriter) Result() string {
 
 	var s bytebufferpool.ByteBuffer
 	for _, p := range p.spans {
-		s.WriteString(p.Result())
+		r, err := p.Result()
+		if err != nil {
+			return "", err
+		}
+		s.WriteString(r)
 	}
 
-	return s.String()
+	return s.String(), nil
 }
 
 func (p *ListWriter) WriteString(s string) {
@@ -394,42 +937,210 @@ type StringSpan struct {
 	s string
 }
 
-func (s *StringSpan) Result() string {
-	return s.s
+func (s *StringSpan) Result() (string, error) {
+	return s.s, nil
 }
 
 func NewListWriter() *ListWriter {
 	return &ListWriter{}
 }
 
+// 异步计算的span, 在另一个协程中调用Done设置结果
 type ChanSpan struct {
-	c       chan string
+	c       chan spanResult
 	getOnce sync.Once
 	setOnce sync.Once
-	r       string
+	r       spanResult
 }
 
-func (p *ChanSpan) Result() string {
+type spanResult struct {
+	s   string
+	err error
+}
+
+func (p *ChanSpan) Result() (string, error) {
 	p.getOnce.Do(func() {
 		p.r = <-p.c
 	})
-	return p.r
+	return p.r.s, p.r.err
 }
 
-func (p *ChanSpan) Done(s string) {
+func (p *ChanSpan) Done(s string, err error) {
 	p.setOnce.Do(func() {
-		p.c <- s
+		p.c <- spanResult{s: s, err: err}
 	})
 }
 
 func NewChanSpan() *ChanSpan {
 	return &ChanSpan{
-		c:       make(chan string, 1),
+		c:       make(chan spanResult, 1),
 		getOnce: sync.Once{},
 		setOnce: sync.Once{},
 	}
 }
 
+// 流式Writer, 用于RenderComponentTo
+// 渲染写入的字符串与span按顺序放入队列, 由另一个协程依次写出, 遇到未完成的span时等待它的结果.
+// 所以未完成的span只会推迟它之后内容的写出, 而不会阻塞渲染, 已经完成的span与之后的内容会被及时写出并释放.
+type streamWriter struct {
+	// 以下字段只在写出协程中使用
+	w  *bufio.Writer
+	fl http.Flusher
+	// 是否还需要在</head>之后flush
+	flushHead bool
+	// 上一次写入的末尾, 用于匹配跨越两次写入的</head>
+	tail string
+	err  error
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// 等待写出的span, text是排在它们之后的字符串
+	queue []Span
+	text  bytebufferpool.ByteBuffer
+	// 渲染已经结束, 写完队列中的内容后退出
+	closed bool
+	// 渲染出错, 不再写出剩下的内容
+	aborted bool
+	done    chan struct{}
+}
+
+const headEndTag = "</head>"
+
+func newStreamWriter(w io.Writer, flushAfterHead bool) *streamWriter {
+	fl, _ := w.(http.Flusher)
+	p := &streamWriter{
+		w:         bufio.NewWriter(w),
+		fl:        fl,
+		flushHead: flushAfterHead && fl != nil,
+		done:      make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	go p.run()
+	return p
+}
+
+func (p *streamWriter) WriteString(s string) {
+	p.mu.Lock()
+	p.text.WriteString(s)
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+func (p *streamWriter) WriteSpan(span Span) {
+	p.mu.Lock()
+	if p.text.Len() != 0 {
+		p.queue = append(p.queue, &StringSpan{s: p.text.String()})
+		p.text.Reset()
+	}
+	p.queue = append(p.queue, span)
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+// 流式写入时结果已经写入w, 所以Result总是返回空
+func (p *streamWriter) Result() (string, error) {
+	return "", nil
+}
+
+// Close 等待所有内容写出, 返回写入过程中的第一个错误
+func (p *streamWriter) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.cond.Signal()
+	<-p.done
+	return p.err
+}
+
+// 渲染出错时调用, 丢弃还没有写出的内容. 等待写出协程退出, 之后不会再写入w
+func (p *streamWriter) abort() {
+	p.mu.Lock()
+	p.closed = true
+	p.aborted = true
+	p.mu.Unlock()
+	p.cond.Signal()
+	<-p.done
+}
+
+// 写出协程
+func (p *streamWriter) run() {
+	defer close(p.done)
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && p.text.Len() == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if p.aborted {
+			p.mu.Unlock()
+			return
+		}
+		spans := p.queue
+		p.queue = nil
+		if len(spans) == 0 && p.text.Len() != 0 {
+			spans = []Span{&StringSpan{s: p.text.String()}}
+			p.text.Reset()
+		}
+		p.mu.Unlock()
+
+		if len(spans) == 0 {
+			// 已经关闭并且写完了所有内容
+			p.flush(false)
+			return
+		}
+		for _, span := range spans {
+			if s, ok := span.(*StringSpan); ok {
+				p.write(s.s)
+				continue
+			}
+			if p.err != nil {
+				continue
+			}
+			// 在等待span之前, 将已有内容发送出去
+			p.flush(false)
+			r, err := span.Result()
+			if err != nil {
+				p.err = err
+				continue
+			}
+			p.write(r)
+		}
+	}
+}
+
+func (p *streamWriter) write(s string) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = p.w.WriteString(s)
+
+	if p.flushHead {
+		if strings.Contains(p.tail+s, headEndTag) {
+			p.flushHead = false
+			p.flush(true)
+			return
+		}
+		if len(s) >= len(headEndTag) {
+			p.tail = s[len(s)-len(headEndTag)+1:]
+		} else {
+			p.tail += s
+			if len(p.tail) >= len(headEndTag) {
+				p.tail = p.tail[len(p.tail)-len(headEndTag)+1:]
+			}
+		}
+	}
+}
+
+// 将缓冲的内容写入w, httpFlush为true时还会调用http.Flusher.Flush
+func (p *streamWriter) flush(httpFlush bool) {
+	if p.err != nil {
+		return
+	}
+	p.err = p.w.Flush()
+	if p.err == nil && httpFlush && p.fl != nil {
+		p.fl.Flush()
+	}
+}
+
 type RenderParam struct {
 	// 声明本次渲染的全局变量, 和vpl.Global()功能类似, 在所有组件中都有效.
 	// 可以用来存放诸如版本号/作者等全部组件都可能需要访问的数据, 还可以存放方法.
@@ -444,9 +1155,17 @@ type RenderParam struct {
 	// 用于在整个运行环境共享变量, 如在一个方法/指令中读取另一个方法/指令里存储的数据
 	Store Store
 
-	// unused so far
+	// 渲染的context, 取消或超时后渲染会停止并返回ctx.Err().
+	// 也会通过RenderCtx.Ctx传递给Function与Directive.
+	// 为nil时使用context.Background()
 	Ctx   context.Context
 	Props *Props
 	// 渲染组件时给组件传递slots
 	Slots *SlotsC
+
+	// 本次渲染中同时执行的<parallel>数量, 0表示使用WithParallelLimit的设置, 小于0表示不限制
+	ParallelLimit int
+
+	// 只在RenderComponentTo中生效, 在写出</head>之后调用http.Flusher.Flush
+	FlushAfterHead bool
 }
@@ -0,0 +1,250 @@
+package vpl
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zbysir/vpl/internal/lib/log"
+)
+
+// 热更新: 定期检查通过ComponentFile与LoadFS注册的文件, 在文件修改后重新编译并替换组件.
+// 使用轮询而不是系统的文件通知, 所以在任何平台(包括容器中挂载的目录)都能工作.
+
+// 通过ComponentFile注册的组件
+type fileSource struct {
+	name string
+	path string
+	// 上一次编译时文件的状态
+	size    int64
+	modTime time.Time
+}
+
+// 文件状态是否有变化
+func (f *fileSource) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		// 文件被删除时保留之前的组件
+		return false
+	}
+	return info.Size() != f.size || !info.ModTime().Equal(f.modTime)
+}
+
+func (v *Vpl) compileFile(f *fileSource) (*compiledComponent, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("readFile err: %w", err)
+	}
+	bs, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("readFile err: %w", err)
+	}
+	// 即使编译失败也记录状态, 避免在文件没有再次修改时重复报错
+	f.size, f.modTime = info.Size(), info.ModTime()
+
+	cp, err := v.compileSource(f.name, f.path, string(bs), nil)
+	if err != nil {
+		return nil, err
+	}
+	cp.file = f
+	return cp, nil
+}
+
+// 通过LoadFS注册的目录
+type dirSource struct {
+	fsys fs.FS
+	root string
+	opts *LoadOptions
+	// 目录中所有组件文件的状态, 用于判断是否有变化
+	sign string
+	// 从这个目录中注册的组件
+	names []string
+}
+
+// 计算目录中所有组件文件的状态
+func (d *dirSource) signature() (string, error) {
+	var b strings.Builder
+	err := walkComponents(d.fsys, d.root, d.opts.exts(), func(p string, e fs.DirEntry) error {
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", p, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return b.String(), err
+}
+
+// Reload 检查一次通过ComponentFile与LoadFS注册的文件, 重新编译修改过的文件, 并一次性替换所有编译成功的组件.
+// 编译失败的组件会保留之前的版本, 错误会通过ErrorList返回.
+// 返回重新加载的组件名.
+func (v *Vpl) Reload() (names []string, err error) {
+	v.reloadMu.Lock()
+	defer v.reloadMu.Unlock()
+
+	v.mu.Lock()
+	files := make([]*fileSource, 0, len(v.files))
+	for _, f := range v.files {
+		files = append(files, f)
+	}
+	dirs := v.dirs
+	// 编译期间其他地方注册的组件比文件中的更新, 替换时需要跳过
+	versions := v.load().versions
+	v.mu.Unlock()
+
+	var errs ErrorList
+	var set []*compiledComponent
+	var remove []string
+	// 重新加载的目录, 在组件替换之后才记录其状态
+	type dirState struct {
+		d    *dirSource
+		sign string
+		// 编译失败时为nil, 保留之前的组件名
+		names []string
+	}
+	var loaded []dirState
+	for _, f := range files {
+		if !f.changed() {
+			continue
+		}
+		cp, err := v.compileFile(f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		set = append(set, cp)
+	}
+
+	for _, d := range dirs {
+		sign, err := d.signature()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if sign == d.sign {
+			continue
+		}
+
+		// 编译失败的文件保留之前的组件, 其他文件照常更新
+		cps, err := v.compileFS(d.fsys, d.root, d.opts)
+		set = append(set, cps...)
+		if err != nil {
+			// 和文件一样也记录状态, 避免在没有再次修改时重复报错
+			loaded = append(loaded, dirState{d: d, sign: sign})
+			if l, ok := err.(ErrorList); ok {
+				errs = append(errs, l...)
+			} else {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		// 删除的文件对应的组件也需要删除
+		exist := make(map[string]bool, len(cps))
+		for _, cp := range cps {
+			exist[cp.name] = true
+		}
+		for _, name := range d.names {
+			if !exist[name] {
+				remove = append(remove, name)
+			}
+		}
+		loaded = append(loaded, dirState{d: d, sign: sign, names: componentNames(cps)})
+	}
+
+	if len(set) != 0 || len(remove) != 0 {
+		set = v.reloadUpdate(versions, set, remove)
+	}
+	for _, l := range loaded {
+		l.d.sign = l.sign
+		if l.names != nil {
+			l.d.names = l.names
+		}
+	}
+	names = componentNames(set)
+	if len(errs) != 0 {
+		return names, errs
+	}
+	return names, nil
+}
+
+// 替换重新加载的组件, 跳过在versions之后被重新注册或删除的组件, 返回实际替换的组件
+func (v *Vpl) reloadUpdate(versions map[string]int64, set []*compiledComponent, remove []string) []*compiledComponent {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	current := v.load().versions
+	var s []*compiledComponent
+	for _, cp := range set {
+		if current[cp.name] == versions[cp.name] {
+			s = append(s, cp)
+		}
+	}
+	var r []string
+	for _, name := range remove {
+		if current[name] == versions[name] {
+			r = append(r, name)
+		}
+	}
+	if len(s) != 0 || len(r) != 0 {
+		v.updateLocked(s, r)
+	}
+	return s
+}
+
+func componentNames(cps []*compiledComponent) []string {
+	names := make([]string, len(cps))
+	for i, cp := range cps {
+		names[i] = cp.name
+	}
+	return names
+}
+
+// WatchOptions 是Watch的选项
+type WatchOptions struct {
+	// 检查文件的间隔, 默认为1s
+	Interval time.Duration
+	// 重新加载了组件之后调用
+	OnReload func(names []string)
+	// 编译失败时调用, 默认打印日志
+	OnError func(err error)
+}
+
+// Watch 定期调用Reload实现热更新, 直到ctx结束, 应该只在开发环境中使用.
+//
+//	go v.Watch(ctx, &vpl.WatchOptions{Interval: 500 * time.Millisecond})
+func (v *Vpl) Watch(ctx context.Context, opts *WatchOptions) error {
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	onError := opts.OnError
+	if onError == nil {
+		onError = func(err error) {
+			log.Errorf("vpl: reload: %v", err)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			names, err := v.Reload()
+			if err != nil {
+				onError(err)
+			}
+			if len(names) != 0 && opts.OnReload != nil {
+				opts.OnReload(names)
+			}
+		}
+	}
+}